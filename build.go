@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildGoms builds goms one after the other.
+func buildGoms(goms []Gom, args []string) (gomErrors, error) {
+	var failed gomErrors
+	for _, gom := range goms {
+		done := gom.prefixOutput()
+		err := gom.buildGom(args, stdout, stderr)
+		done()
+		if err != nil {
+			if !*keepGoing {
+				return failed, err
+			}
+			failed = append(failed, gomError{gom.name, err})
+		}
+	}
+	return failed, nil
+}
+
+// buildParallel builds as many goms at once as there are CPUs, each only
+// after the goms whose packages it imports. If the imports can't be worked
+// out, the goms are built one after the other instead.
+func buildParallel(goms []Gom, args []string) (gomErrors, error) {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := buildDeps(vendor, goms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: building sequentially, %v\n", err)
+		return buildGoms(goms, args)
+	}
+
+	for _, gom := range goms {
+		// results isn't safe for concurrent use
+		results.get(gom.name)
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+		errs    = make([]error, len(goms))
+		built   = make([]chan struct{}, len(goms))
+		slots   = make(chan struct{}, runtime.NumCPU())
+	)
+	for i := range goms {
+		built[i] = make(chan struct{})
+	}
+	for i := range goms {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(built[i])
+			for _, j := range deps[i] {
+				<-built[j]
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			mu.Lock()
+			stop := stopped
+			mu.Unlock()
+			if stop {
+				return
+			}
+			gom := goms[i]
+			out := newPrefixWriter(stdout, gom.name+": ")
+			errOut := newPrefixWriter(stderr, gom.name+": ")
+			errs[i] = gom.buildGom(args, out, errOut)
+			out.Flush()
+			errOut.Flush()
+			if errs[i] != nil && !*keepGoing {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failed gomErrors
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !*keepGoing {
+			return nil, err
+		}
+		failed = append(failed, gomError{goms[i].name, err})
+	}
+	return failed, nil
+}
+
+// buildDeps returns, for each of goms, the indexes of the goms whose
+// packages its packages import, read from their sources in vendor. It fails
+// if a package can't be read or the goms import each other in a cycle.
+func buildDeps(vendor string, goms []Gom) ([][]int, error) {
+	targets := make([]string, len(goms))
+	for i, gom := range goms {
+		targets[i] = gom.Target()
+	}
+	// owner returns the index of the gom path belongs to, the one with the
+	// longest target if targets nest.
+	owner := func(path string) int {
+		found := -1
+		for i, target := range targets {
+			if path != target && !strings.HasPrefix(path, target+"/") {
+				continue
+			}
+			if found < 0 || len(target) > len(targets[found]) {
+				found = i
+			}
+		}
+		return found
+	}
+
+	deps := make([][]int, len(goms))
+	for i, target := range targets {
+		imports, err := packageImports(filepath.Join(vendorSrc(vendor), filepath.FromSlash(target)))
+		if err != nil {
+			return nil, fmt.Errorf("can't read the imports of %s: %v", goms[i].name, err)
+		}
+		seen := make(map[int]bool)
+		for _, imp := range imports {
+			j := owner(imp)
+			if j < 0 || j == i || seen[j] {
+				continue
+			}
+			seen[j] = true
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	// Every gom must be reachable in build order, or there is a cycle.
+	state := make([]int, len(goms)) // 0 unvisited, 1 visiting, 2 done
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("%s imports itself through other packages", goms[i].name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		return nil
+	}
+	for i := range goms {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// packageImports returns the imports of the packages in dir and below it,
+// leaving out tests, testdata and the directories go ignores.
+func packageImports(dir string) ([]string, error) {
+	var imports []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		name := fi.Name()
+		if p != dir && (vcsMetadata[name] || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		pkg, err := build.ImportDir(p, 0)
+		if err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+			return err
+		}
+		imports = append(imports, pkg.Imports...)
+		return nil
+	})
+	return imports, err
+}
+
+// buildGom builds gom, unless it is unchanged since the last install,
+// writing what its commands print to out and errOut, and records how that
+// went in results.
+func (gom *Gom) buildGom(args []string, out, errOut io.Writer) error {
+	res, start := results.get(gom.name), time.Now()
+	if gom.unchanged {
+		return nil
+	}
+	err := gom.build(args, out, errOut)
+	res.since("build", start)
+	res.Built = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return err
+}
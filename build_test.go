@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildDeps(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	write := func(path, imports string) {
+		dir := filepath.Join(vendor, "src", filepath.FromSlash(path))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := "package " + filepath.Base(dir) + "\n\nimport (\n" + imports + ")\n"
+		err = ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("example.com/a", "\t\"fmt\"\n\t\"example.com/b/sub\"\n")
+	write("example.com/b/sub", "\t\"strings\"\n")
+	write("example.com/c", "\t\"example.com/a\"\n\t\"example.com/b\"\n")
+	write("example.com/c/internal", "\t\"example.com/a\"\n")
+	write("example.com/b", "")
+
+	goms := []Gom{
+		{name: "example.com/a", options: map[string]interface{}{}},
+		{name: "example.com/b", options: map[string]interface{}{}},
+		{name: "example.com/c", options: map[string]interface{}{}},
+	}
+	deps, err := buildDeps(vendor, goms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int{{1}, nil, {0, 1}}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, deps)
+	}
+
+	write("example.com/b", "\t\"example.com/c\"\n")
+	_, err = buildDeps(vendor, goms)
+	if err == nil {
+		t.Fatalf("Expected an import cycle error, but none")
+	}
+}
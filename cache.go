@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cacheDir returns the directory holding cached repository tarballs.
+// GOM_CACHE overrides the default of $HOME/.gom/dl.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("GOM_CACHE"); dir != "" {
+		return filepath.Abs(dir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".gom", "dl"), nil
+}
+
+// cacheFile returns the tarball gom is cached in. Only goms pinned to a
+// commit are cached, since anything else may change upstream.
+func (gom *Gom) cacheFile() (string, bool) {
+	if *noCache {
+		return "", false
+	}
+	commit, ok := gom.options["commit"].(string)
+	if !ok || commit == "" {
+		return "", false
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(gom.name), commit+".tar.gz"), true
+}
+
+// cacheSrcDir returns the vendored directory that is stored in the cache.
+func (gom *Gom) cacheSrcDir(vendor string) string {
+	target := gom.Target()
+	if !has(gom.options, "target") && !gom.module() {
+		// a module is a directory of its own, a repository may hold more
+		target = gom.repoRoot()
+	}
+	return filepath.Join(vendor, "src", target)
+}
+
+// restoreCache unpacks gom from the cache, reporting whether it was found.
+func (gom *Gom) restoreCache(vendor string) (bool, error) {
+	file, ok := gom.cacheFile()
+	if !ok || !isFile(file) {
+		return false, nil
+	}
+	srcdir := gom.cacheSrcDir(vendor)
+	if isDir(srcdir) {
+		return true, nil
+	}
+	fmt.Printf("%srestoring %s from %s\n", gom.progress(), gom.name, file)
+	if *dryRun {
+		return true, nil
+	}
+	if err := untarDir(file, srcdir); err != nil {
+		os.RemoveAll(srcdir)
+		return false, err
+	}
+	return true, nil
+}
+
+// storeCache saves the checked out gom into the cache if it isn't there yet.
+func (gom *Gom) storeCache(vendor string) error {
+	file, ok := gom.cacheFile()
+	if !ok || isFile(file) || *dryRun {
+		return nil
+	}
+	srcdir := gom.cacheSrcDir(vendor)
+	if !isDir(srcdir) || isSymlink(srcdir) {
+		// a symlink points at a checkout gom didn't fetch
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("caching %s in %s\n", gom.name, file)
+	}
+	tmp := file + ".tmp"
+	if err := tarDir(srcdir, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func tarDir(dir, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		r, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func untarDir(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(p, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("%s: invalid path %q", file, hdr.Name)
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, mode|0700)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, p)
+		case tar.TypeReg:
+			var w *os.File
+			w, err = os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err == nil {
+				_, err = io.Copy(w, tr)
+				if cerr := w.Close(); err == nil {
+					err = cerr
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheTarball(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, ".git", "HEAD"), []byte("ref: refs/heads/master\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("main.go", filepath.Join(src, "link.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "src.tar.gz")
+	err = tarDir(src, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	err = untarDir(file, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package main\n" {
+		t.Fatalf("Expected %q, but %q:", "package main\n", string(b))
+	}
+	if !isFile(filepath.Join(dst, ".git", "HEAD")) {
+		t.Fatal("Expected .git/HEAD to be restored")
+	}
+	link, err := os.Readlink(filepath.Join(dst, "link.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "main.go" {
+		t.Fatalf("Expected %q, but %q:", "main.go", link)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "fmt"
+
+// check parses the Gomfile, with the goms of every group, and validates
+// their options and targets, then validates them again as pinned by its
+// lock file, if there is one, the way install reads them. Nothing is
+// fetched or written, and the environment stays as it is.
+func check() error {
+	if err := checkGomfile(*gomFileName); err != nil {
+		return err
+	}
+	if *gomFileName == "-" {
+		fmt.Println("the Gomfile on stdin is valid")
+	} else {
+		fmt.Printf("%s is valid\n", *gomFileName)
+	}
+	return nil
+}
+
+// checkGomfile parses and validates filename, and validates its goms again
+// once filename.lock pinned them. The lock file pins to a commit while
+// keeping the tag, which a Gomfile couldn't, so it isn't validated alone.
+func checkGomfile(filename string) error {
+	allGroups = true
+	defer func() { allGroups = false }()
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		return err
+	}
+	name := filename
+	if name == "-" {
+		name = "stdin"
+	}
+	if err := validateGoms(goms); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	err = lockGoms(filename, goms)
+	if err == nil {
+		err = validateGoms(goms)
+	}
+	if err != nil {
+		return fmt.Errorf("%s.lock: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// vcsMetadata lists the directories and files VCSs keep their metadata in,
+// which differ between two clones of the same revision.
+var vcsMetadata = map[string]bool{
+	".git":      true,
+	".hg":       true,
+	".bzr":      true,
+	".svn":      true,
+	"_darcs":    true,
+	".fslckout": true,
+	"_FOSSIL_":  true,
+	moduleStamp: true,
+}
+
+var re_sha256 = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// treeHash returns the SHA-256 of the files below dir, leaving out VCS
+// metadata. Every file adds its slash-separated path and the SHA-256 of its
+// contents, or the target of a symlink, to the hash in lexical order.
+func treeHash(dir string) (string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if vcsMetadata[fi.Name()] {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s -> %s\n", filepath.ToSlash(rel), filepath.ToSlash(link))
+		case fi.Mode().IsRegular():
+			sum, err := fileHash(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkHash fails unless the sources of gom hash to its sha256 option.
+func (gom *Gom) checkHash(vendor string) error {
+	expected, ok := gom.options["sha256"].(string)
+	if !ok || *dryRun {
+		return nil
+	}
+	sum, err := treeHash(gom.cacheSrcDir(vendor))
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return fmt.Errorf("sources of %s have SHA-256 %s, but %s was expected", gom.name, sum, expected)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTreeHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sums []string
+	for i, content := range []string{"package x\n", "package x\n", "package y\n"} {
+		root := filepath.Join(dir, string('a'+rune(i)))
+		err = os.MkdirAll(filepath.Join(root, ".git"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// metadata differs between clones, and is left out
+		err = ioutil.WriteFile(filepath.Join(root, ".git", "index"), []byte(root), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(root, "x.go"), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := treeHash(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !re_sha256.MatchString(sum) {
+			t.Fatalf("Expected a SHA-256, but %v:", sum)
+		}
+		sums = append(sums, sum)
+	}
+	if sums[0] != sums[1] {
+		t.Fatalf("Expected %v, but %v:", sums[0], sums[1])
+	}
+	if sums[0] == sums[2] {
+		t.Fatalf("Expected a hash other than %v:", sums[0])
+	}
+}
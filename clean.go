@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkCleanable refuses to clean a vendor directory that is more likely
+// a mistake than a vendor directory: the root, the home directory, a
+// GOPATH entry, or the current directory or one of its parents, which is
+// what GOM_VENDOR_NAME=. gives. Symlinks are resolved on both sides, so a
+// link to one of those is refused too.
+func checkCleanable(vendor string) error {
+	real := realPath(vendor)
+	suspicious := []string{string(filepath.Separator)}
+	if home, err := os.UserHomeDir(); err == nil {
+		suspicious = append(suspicious, home)
+	}
+	suspicious = append(suspicious, filepath.SplitList(os.Getenv("GOPATH"))...)
+	for _, dir := range suspicious {
+		if dir != "" && realPath(dir) == real {
+			return fmt.Errorf("refusing to clean %s", vendor)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cwd = realPath(cwd)
+	if cwd == real || strings.HasPrefix(cwd, real+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to clean %s, which holds the current directory", vendor)
+	}
+	return nil
+}
+
+// realPath returns the absolute path of p with symlinks resolved, or as
+// much of that as can be found out when p doesn't exist.
+func realPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		return real
+	}
+	return p
+}
+
+// clean removes the vendored packages, so that the next install starts
+// afresh. Installed binaries are only removed with -all.
+func clean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	all := fs.Bool("all", false, "remove installed binaries too")
+	force := fs.Bool("f", false, "don't ask for confirmation")
+	fs.Parse(args)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	if !isDir(vendor) {
+		return nil
+	}
+	err = checkCleanable(vendor)
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	if go15VendorExperimentEnv {
+		// the packages are right in the vendor directory
+		names, err := readdirnames(vendor)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if name != "bin" {
+				dirs = append(dirs, filepath.Join(vendor, name))
+			}
+		}
+	} else {
+		dirs = []string{vendorSrc(vendor), filepath.Join(vendor, "pkg"), filepath.Join(vendor, installStateFile)}
+	}
+	if *all {
+		dirs = append(dirs, filepath.Join(vendor, "bin"))
+	}
+	var existing []string
+	for _, dir := range dirs {
+		if _, err := os.Lstat(dir); err == nil {
+			existing = append(existing, dir)
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	if !*force && !*dryRun {
+		fmt.Printf("Remove %s? [y/N] ", strings.Join(existing, ", "))
+		answer, _ := bufio.NewReader(stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+	for _, dir := range existing {
+		fmt.Printf("removing %s\n", dir)
+		if *dryRun {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCleanable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := filepath.Join(dir, "home")
+	gopath1 := filepath.Join(dir, "go1")
+	gopath2 := filepath.Join(dir, "go2")
+	project := filepath.Join(dir, "work", "project")
+	vendor := filepath.Join(project, "_vendor")
+	for _, p := range []string{home, gopath1, gopath2, vendor} {
+		err = os.MkdirAll(p, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath1+string(filepath.ListSeparator)+gopath2)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	tests := []struct {
+		vendor string
+		ok     bool
+	}{
+		{string(filepath.Separator), false},
+		{home, false},
+		{gopath1, false},
+		{gopath2, false},
+		{project, false},
+		{filepath.Join(dir, "work"), false},
+		{dir, false},
+		{vendor, true},
+		{filepath.Join(home, "shared"), true},
+	}
+	links := filepath.Join(dir, "links")
+	err = os.Mkdir(links, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests[:len(tests)-1] {
+		// a symlink must get the same answer as what it points to
+		link := filepath.Join(links, string(rune('a'+i)))
+		err = os.Symlink(test.vendor, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, struct {
+			vendor string
+			ok     bool
+		}{link, test.ok})
+	}
+	for _, test := range tests {
+		err := checkCleanable(test.vendor)
+		if (err == nil) != test.ok {
+			t.Fatalf("Expected %v, but %v: %s", test.ok, err, test.vendor)
+		}
+	}
+
+	// working in the project through a symlink still protects it
+	linked := filepath.Join(links, "project")
+	err = os.Symlink(project, linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PWD", os.Getenv("PWD"))
+	os.Setenv("PWD", linked)
+	if err := checkCleanable(project); err == nil {
+		t.Fatalf("Expected %v, but %v: %s", false, err, project)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gomEnv is the environment gom builds and runs commands with.
+type gomEnv struct {
+	GOPATH    string `json:"GOPATH"`
+	GOBIN     string `json:"GOBIN"`
+	PATH      string `json:"PATH"`
+	GomVendor string `json:"GOM_VENDOR"`
+}
+
+// env prints the environment of gom as shell exports, or as JSON with
+// -json, so that scripts can eval it. With any other arguments it runs
+// go env.
+func env(args []string) error {
+	asJSON := *jsonOutput
+	if len(args) == 1 && (args[0] == "-json" || args[0] == "--json") {
+		asJSON, args = true, nil
+	}
+	if len(args) > 0 {
+		return run(append([]string{"go", "env"}, args...), None)
+	}
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	gopath, gobin, err := vendorEnv(vendor)
+	if err != nil {
+		return err
+	}
+	e := gomEnv{
+		GOPATH:    gopath,
+		GOBIN:     gobin,
+		PATH:      prependPath(os.Getenv("PATH"), gobin),
+		GomVendor: vendor,
+	}
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+	fmt.Fprintf(stdout, "export GOPATH=%s\n", shellQuote(e.GOPATH))
+	fmt.Fprintf(stdout, "export GOBIN=%s\n", shellQuote(e.GOBIN))
+	fmt.Fprintf(stdout, "export PATH=%s\n", shellQuote(e.PATH))
+	fmt.Fprintf(stdout, "export GOM_VENDOR=%s\n", shellQuote(e.GomVendor))
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -18,25 +21,125 @@ const (
 	Blue
 )
 
+var colorCodes = map[Color]string{
+	Red:  "\x1b[31m",
+	Blue: "\x1b[34m",
+}
+
+// colorEnabled reports whether output may be colored, which is when stdout
+// is a terminal and neither -no-color nor NO_COLOR is set.
+func colorEnabled() bool {
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize returns s in color c, or s itself when color is off.
+func colorize(s string, c Color) string {
+	if c == None || !colorEnabled() {
+		return s
+	}
+	return colorCodes[c] + s + "\x1b[0m"
+}
+
+// rootCtx is cancelled when gom is interrupted, which kills the VCS
+// commands that are running. A second signal exits right away, unless a
+// cleanup step is running, in which case gom exits once it is done.
+var rootCtx, interrupt = context.WithCancel(context.Background())
+
+// cleanup is held while a cleanup step runs, and step says what it does.
+var cleanup sync.Mutex
+var step struct {
+	sync.Mutex
+	what string
+}
+
 func handleSignal() {
 	sc := make(chan os.Signal, 10)
 	signal.Notify(sc, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 	go func() {
 		<-sc
-		os.Exit(0)
+		interrupt()
+		if what := runningStep(); what != "" {
+			fmt.Fprintf(os.Stderr, "gom: interrupted, finishing %s first\n", what)
+		}
+		<-sc
+		if what := runningStep(); what != "" {
+			fmt.Fprintf(os.Stderr, "gom: still %s, exiting once that is done\n", what)
+		}
+		cleanup.Lock()
+		os.Exit(1)
 	}()
 }
 
+// cleanupStep marks the start of a step that leaves the vendor tree
+// inconsistent when it is cut short, like moving it around, so that
+// signals don't stop it. The returned function marks its end.
+func cleanupStep(what string) func() {
+	cleanup.Lock()
+	step.Lock()
+	step.what = what
+	step.Unlock()
+	return func() {
+		step.Lock()
+		step.what = ""
+		step.Unlock()
+		cleanup.Unlock()
+	}
+}
+
+// runningStep returns what the running cleanup step does, or "".
+func runningStep() string {
+	step.Lock()
+	defer step.Unlock()
+	return step.what
+}
+
+// command returns a command for args that is killed, together with the
+// processes it started, when it runs longer than -timeout or gom is
+// interrupted. The error of running it should be passed through done.
+func command(args []string) (cmd *exec.Cmd, done func(error) error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(rootCtx, *timeout)
+	} else {
+		ctx, cancel = context.WithCancel(rootCtx)
+	}
+	cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	traced := traceCommand(args)
+	return cmd, func(err error) error {
+		defer cancel()
+		traced(cmd.Dir, err)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() == context.DeadlineExceeded:
+			return fmt.Errorf("%s: timed out after %v", redact(strings.Join(args, " ")), *timeout)
+		case rootCtx.Err() != nil:
+			return fmt.Errorf("%s: interrupted", redact(strings.Join(args, " ")))
+		}
+		return err
+	}
+}
+
 func ready() error {
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
 	}
 
-	binPath := strings.Join(
-		[]string{filepath.Join(vendor, "bin"), os.Getenv("PATH")},
-		string(filepath.ListSeparator),
-	)
+	gobin, err := gobinDir(vendor)
+	if err != nil {
+		return err
+	}
+	binPath := prependPath(os.Getenv("PATH"), gobin)
 
 	if *verbose {
 		fmt.Printf("export PATH=%s\n", binPath)
@@ -46,10 +149,7 @@ func ready() error {
 		return err
 	}
 
-	gopath := strings.Join(
-		[]string{vendor, os.Getenv("GOPATH")},
-		string(filepath.ListSeparator),
-	)
+	gopath := prependPath(os.Getenv("GOPATH"), vendor)
 	if *verbose {
 		fmt.Printf("export GOPATH=%s\n", gopath)
 	}
@@ -61,24 +161,229 @@ func ready() error {
 	return nil
 }
 
-var stdout = os.Stdout
-var stderr = os.Stderr
+// saveEnv saves the environment variables names, and returns a function
+// that sets them back to what they were, unsetting those that weren't set.
+func saveEnv(names ...string) func() {
+	saved := make(map[string]*string)
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			saved[name] = &value
+		} else {
+			saved[name] = nil
+		}
+	}
+	return func() {
+		for name, value := range saved {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	}
+}
+
+// prependPath puts dir in front of the path list, unless it is there already.
+func prependPath(list, dir string) string {
+	if list == "" {
+		return dir
+	}
+	if filepath.SplitList(list)[0] == dir {
+		return list
+	}
+	return dir + string(filepath.ListSeparator) + list
+}
+
+// stdout and stderr are where the commands gom runs print.
+var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
 var stdin = os.Stdin
 
 func run(args []string, c Color) error {
+	return runEnv(args, nil, c)
+}
+
+// secrets holds the strings, such as tokens, that redact hides. goms
+// fetched at once add theirs at once.
+var secrets []string
+var secretsMu sync.Mutex
+
+func addSecret(secret string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if !has(secrets, secret) {
+		secrets = append(secrets, secret)
+	}
+}
+
+// redact hides the secrets in s, so that it can be printed.
+func redact(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, "***", -1)
+	}
+	return s
+}
+
+// runEnv is run with env added to the environment of the command.
+func runEnv(args []string, env []string, c Color) error {
 	if err := ready(); err != nil {
 		return err
 	}
 	if len(args) == 0 {
 		usage()
 	}
-	if *verbose {
-		fmt.Printf("%q\n", args)
+	if *verbose || *dryRun {
+		fmt.Println(colorize(fmt.Sprintf("%s%q", strings.Join(append(env, ""), " "), args), c))
+	}
+	if *dryRun {
+		return nil
 	}
 	cmd := exec.Command(args[0], args[1:]...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	cmd.Stdin = stdin
+	traced := traceCommand(args)
 	err := cmd.Run()
+	traced(cmd.Dir, err)
 	return err
 }
+
+// runVCS runs a command that fetches sources, such as go get or git clone.
+// Unlike run it doesn't read stdin, and it is subject to -timeout.
+func runVCS(args []string, env []string) error {
+	return runVCSOut(args, env, stdout, stderr)
+}
+
+// runVCSOut is runVCS writing what the command prints to out and errOut.
+func runVCSOut(args []string, env []string, out, errOut io.Writer) error {
+	if err := ready(); err != nil {
+		return err
+	}
+	if *verbose || *dryRun {
+		fmt.Println(colorize(redact(fmt.Sprintf("%s%q", strings.Join(append(env, ""), " "), args)), Blue))
+	}
+	if *dryRun {
+		return nil
+	}
+	cmd, done := command(args)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	return done(cmd.Run())
+}
+
+// execVendor runs a command with GOPATH and GOBIN set up the way install
+// sets them up. With the go1.5 vendor experiment the vendored sources are
+// moved under src for the duration of the command, and moved back after.
+func execVendor(args []string) error {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	defer saveEnv("GOPATH", "GOBIN")()
+	err = setupVendorEnv(vendor)
+	if err != nil {
+		return err
+	}
+	if flat := flatSrc(vendor); flat == "" || !isDir(flat) {
+		return run(args, None)
+	}
+
+	err = moveSrcToVendorSrc(vendor)
+	if err != nil {
+		return err
+	}
+	err = run(args, None)
+	if merr := moveSrcToVendor(vendor); err == nil {
+		err = merr
+	}
+	return err
+}
+
+// doc runs go doc on a vendored package, so that it shows the pinned
+// version instead of the one in the global GOPATH. Flags such as -all
+// and further arguments, like a symbol, are passed on to go doc.
+func doc(args []string) error {
+	pkg := ""
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			pkg = arg
+			break
+		}
+	}
+	if pkg == "" {
+		usage()
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	if !isDir(filepath.Join(vendorSrc(vendor), filepath.FromSlash(pkg))) {
+		return fmt.Errorf("%s is not vendored in %s", pkg, vendorFolder)
+	}
+	return execVendor(append([]string{"go", "doc"}, args...))
+}
+
+// runVendor runs a main package, the one in the current directory unless
+// args name another, with the bundles. The arguments after -- go to the
+// program.
+func runVendor(args []string) error {
+	var pkgs, progArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			progArgs = args[i+1:]
+			break
+		}
+		pkgs = append(pkgs, arg)
+	}
+	hasPkg := false
+	for _, pkg := range pkgs {
+		hasPkg = hasPkg || !strings.HasPrefix(pkg, "-")
+	}
+	if !hasPkg {
+		pkgs = append(pkgs, ".")
+	}
+	return execVendor(append(append([]string{"go", "run"}, pkgs...), progArgs...))
+}
+
+// testVendor runs go test with the vendored packages: gom test [-update]
+// [packages] [-- test flags]. The packages default to ./..., and -update
+// installs the Gomfile first.
+func testVendor(args []string) error {
+	if len(args) > 0 && (args[0] == "-update" || args[0] == "--update") {
+		args = args[1:]
+		_, err := populate(nil)
+		if err != nil {
+			return err
+		}
+	}
+	var pkgs, flags []string
+	for i, arg := range args {
+		if arg == "--" {
+			flags = args[i+1:]
+			break
+		}
+		pkgs = append(pkgs, arg)
+	}
+	hasPkg := false
+	for _, pkg := range pkgs {
+		hasPkg = hasPkg || !strings.HasPrefix(pkg, "-")
+	}
+	if !hasPkg {
+		pkgs = append(pkgs, "./...")
+	}
+	return execVendor(append(append([]string{"go", "test"}, flags...), pkgs...))
+}
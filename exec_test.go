@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -8,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestExec(t *testing.T) {
@@ -60,7 +63,12 @@ func TestExec(t *testing.T) {
 				gopath = item[1][7:]
 			}
 		} else if strings.HasPrefix(line, "GOPATH=") {
-			gopath, _ = strconv.Unquote(line[7:])
+			gopath = line[7:]
+			if strings.HasPrefix(gopath, "'") {
+				gopath = strings.Trim(gopath, "'")
+			} else {
+				gopath, _ = strconv.Unquote(gopath)
+			}
 		}
 	}
 	found := false
@@ -76,3 +84,264 @@ func TestExec(t *testing.T) {
 		t.Fatalf("Expected %v, but %v:", vendor, gopath)
 	}
 }
+
+func TestPrependPath(t *testing.T) {
+	sep := string(filepath.ListSeparator)
+	tests := []struct {
+		list     string
+		expected string
+	}{
+		{"", "/vendor"},
+		{"/go", "/vendor" + sep + "/go"},
+		{"/vendor" + sep + "/go", "/vendor" + sep + "/go"},
+		{"/go" + sep + "/vendor", "/vendor" + sep + "/go" + sep + "/vendor"},
+	}
+	for _, test := range tests {
+		if got := prependPath(test.list, "/vendor"); got != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, got)
+		}
+	}
+}
+
+func TestExecVendor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	defer func(v bool) { *isolate = v }(*isolate)
+	*isolate = true
+
+	out := filepath.Join(dir, "env")
+	err = execVendor([]string{"--", "sh", "-c", `echo "$GOPATH $GOBIN" > ` + out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := vendorFolder + " " + filepath.Join(vendorFolder, "bin")
+	if got := strings.TrimSpace(string(b)); got != expected {
+		t.Fatalf("Expected %v, but %v:", expected, got)
+	}
+}
+
+func TestEnvDuration(t *testing.T) {
+	defer os.Setenv("GOM_TIMEOUT", os.Getenv("GOM_TIMEOUT"))
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 10 * time.Minute},
+		{"2m", 2 * time.Minute},
+		{"0", 0},
+		{"forever", 10 * time.Minute},
+	}
+	for _, test := range tests {
+		os.Setenv("GOM_TIMEOUT", test.value)
+		if d := envDuration("GOM_TIMEOUT", 10*time.Minute); d != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, d)
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	defer func(v time.Duration) { *timeout = v }(*timeout)
+	*timeout = 200 * time.Millisecond
+
+	cmd, done := command([]string{"true"})
+	if err := done(cmd.Run()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shell's child must be killed too, or Run waits for it
+	start := time.Now()
+	cmd, done = command([]string{"sh", "-c", "sleep 30; true"})
+	cmd.Stdout = ioutil.Discard
+	err := done(cmd.Run())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected %v, but %v:", "a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected %v, but %v:", *timeout, elapsed)
+	}
+}
+
+func TestDoc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	pkg := filepath.Join(vendorFolder, "src", "example.com", "width")
+	err = os.MkdirAll(pkg, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(pkg, "width.go"), []byte(`package width
+
+// StringWidth returns the vendored width of s.
+func StringWidth(s string) int { return len(s) }
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = doc([]string{"-short", "example.com/other"})
+	if err == nil {
+		t.Fatalf("Expected %v, but %v:", "an error", err)
+	}
+
+	f, err := ioutil.TempFile(dir, "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = f
+	err = doc([]string{"example.com/width", "StringWidth"})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "returns the vendored width") {
+		t.Fatalf("Expected %v, but %v:", "the vendored doc comment", string(b))
+	}
+}
+
+func TestColorize(t *testing.T) {
+	defer func(v bool) { *noColor = v }(*noColor)
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	os.Setenv("NO_COLOR", "")
+	*noColor = false
+
+	// output that isn't a terminal is never colored
+	out := captureStdout(t, func() {
+		fmt.Print(colorize("fetching", Blue))
+	})
+	if out != "fetching" {
+		t.Fatalf("Expected %q, but %q:", "fetching", out)
+	}
+
+	if colorize("fetching", None) != "fetching" {
+		t.Fatalf("Expected %q, but %q:", "fetching", colorize("fetching", None))
+	}
+
+	*noColor = true
+	if colorEnabled() {
+		t.Fatalf("Expected %v, but %v:", false, true)
+	}
+	*noColor = false
+	os.Setenv("NO_COLOR", "1")
+	if colorEnabled() {
+		t.Fatalf("Expected %v, but %v:", false, true)
+	}
+}
+
+func TestTestVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		filepath.Join(dir, "a", "a_test.go"): `package a
+import "testing"
+func TestPass(t *testing.T) {}`,
+		filepath.Join(dir, "b", "b_test.go"): `package b
+import "testing"
+func TestPass(t *testing.T) {}
+func TestFail(t *testing.T) { t.Fatal("fail") }`,
+	}
+	for p, src := range files {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(src+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	defer func(out, err io.Writer) { stdout, stderr = out, err }(stdout, stderr)
+	stdout, stderr = devnull, devnull
+
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, false},
+		{[]string{"./a"}, true},
+		{[]string{"--", "-run", "TestPass"}, true},
+		{[]string{"./...", "--", "-run", "TestFail"}, false},
+	}
+	for _, test := range tests {
+		err := testVendor(test.args)
+		if (err == nil) != test.ok {
+			t.Fatalf("Expected %v, but %v: %q", test.ok, err, test.args)
+		}
+	}
+}
+
+func TestSaveEnv(t *testing.T) {
+	os.Setenv("GOM_TEST_SET", "before")
+	os.Unsetenv("GOM_TEST_UNSET")
+	restore := saveEnv("GOM_TEST_SET", "GOM_TEST_UNSET")
+	os.Setenv("GOM_TEST_SET", "after")
+	os.Setenv("GOM_TEST_UNSET", "after")
+	restore()
+	if value := os.Getenv("GOM_TEST_SET"); value != "before" {
+		t.Fatalf("Expected %v, but %v:", "before", value)
+	}
+	if value, ok := os.LookupEnv("GOM_TEST_UNSET"); ok {
+		t.Fatalf("Expected %v to be unset, but %v:", "GOM_TEST_UNSET", value)
+	}
+	os.Unsetenv("GOM_TEST_SET")
+}
+
+func TestCleanupStep(t *testing.T) {
+	done := cleanupStep("moving things")
+	if what := runningStep(); what != "moving things" {
+		t.Fatalf("Expected %v, but %v:", "moving things", what)
+	}
+	done()
+	if what := runningStep(); what != "" {
+		t.Fatalf("Expected no step, but %v:", what)
+	}
+}
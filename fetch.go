@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchSequential fetches goms one after the other. It returns the goms
+// that were fetched, and with -keep-going the failures of the others.
+func fetchSequential(vendor string, goms []Gom, args []string) ([]Gom, gomErrors, error) {
+	var failed gomErrors
+	fetched := make([]Gom, 0, len(goms))
+	for _, gom := range goms {
+		done := gom.prefixOutput()
+		err := gom.fetch(vendor, args)
+		done()
+		if err != nil {
+			if !*keepGoing {
+				return nil, nil, err
+			}
+			failed = append(failed, gomError{gom.name, err})
+			continue
+		}
+		fetched = append(fetched, gom)
+	}
+	return fetched, failed, nil
+}
+
+// fetchParallel fetches up to -max-concurrent-fetches goms at once, and
+// up to -max-host-fetches of them from the same host, so that big installs
+// stay below the rate limits of hosts such as GitHub. What the commands
+// print isn't tagged with the names of the goms, since they share stdout
+// and stderr.
+func fetchParallel(vendor string, goms []Gom, args []string) ([]Gom, gomErrors, error) {
+	for _, gom := range goms {
+		// results isn't safe for concurrent use
+		results.get(gom.name)
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+		errs    = make([]error, len(goms))
+		slots   = make(chan struct{}, *maxFetches)
+		hosts   = make(map[string]chan struct{})
+	)
+	for _, gom := range goms {
+		host := gom.host()
+		if hosts[host] == nil {
+			hosts[host] = make(chan struct{}, *maxHostFetches)
+		}
+	}
+	for i := range goms {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gom := goms[i]
+			// a host slot first, so that goms waiting for their host
+			// don't keep others from fetching
+			host := hosts[gom.host()]
+			host <- struct{}{}
+			defer func() { <-host }()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			mu.Lock()
+			stop := stopped
+			mu.Unlock()
+			if stop {
+				errs[i] = errSkipped
+				return
+			}
+			errs[i] = gom.fetch(vendor, args)
+			if errs[i] != nil && !*keepGoing {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failed gomErrors
+	fetched := make([]Gom, 0, len(goms))
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			fetched = append(fetched, goms[i])
+		case err == errSkipped:
+		case !*keepGoing:
+			return nil, nil, err
+		default:
+			failed = append(failed, gomError{goms[i].name, err})
+		}
+	}
+	return fetched, failed, nil
+}
+
+// errSkipped is what fetchParallel records for the goms it didn't fetch
+// after another one failed.
+var errSkipped = errors.New("skipped")
+
+// host returns the host gom is fetched from, going by its import path.
+func (gom *Gom) host() string {
+	return strings.SplitN(gom.name, "/", 2)[0]
+}
+
+// fetch clones gom, unless it is in the download cache or unchanged since
+// the last install, recording how in its results.
+func (gom *Gom) fetch(vendor string, args []string) error {
+	res, start := results.get(gom.name), time.Now()
+	if gom.unchanged {
+		res.Fetch = "unchanged"
+		return nil
+	}
+	res.Fetch = "cloned"
+	if isDir(gom.cacheSrcDir(vendor)) {
+		res.Fetch = "existing"
+	}
+	if cached, err := gom.restoreCache(vendor); err != nil {
+		fmt.Printf("Warning: can't restore %s from cache: %v\n", gom.name, err)
+	} else if cached {
+		if res.Fetch != "existing" {
+			res.Fetch = "cached"
+		}
+		res.since("clone", start)
+		return nil
+	}
+	err := gom.Clone(args)
+	res.since("clone", start)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return err
+}
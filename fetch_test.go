@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGomHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-runewidth", "github.com"},
+		{"gopkg.in/yaml.v2", "gopkg.in"},
+		{"example.com", "example.com"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: test.name, options: map[string]interface{}{}}
+		if host := gom.host(); host != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, host)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var re_gom_name = regexp.MustCompile(`^(\s*gom\s+(` + qx + `))`)
+var re_pin = regexp.MustCompile(`:(?:commit|tag|branch|bookmark|date)(\s*=>\s*)(?:` + qx + `)`)
+
+// re_unpinned matches the options a gom pinned to a commit can't keep,
+// with the comma before and after them: the branch a date was on, or the
+// date on a branch, and track.
+var re_unpinned = regexp.MustCompile(`(,[ \t]*)?:(?:branch|date|track)\s*=>\s*(?:` + qx + `)([ \t]*,[ \t]*)?`)
+
+// freeze rewrites the Gomfile, pinning every installed gom to the commit it
+// is at in place of its tag, branch, bookmark or date. Everything else, comments
+// included, stays as it is. With -o the Gomfile is written to another
+// file, or to stdout if that is -.
+func freeze(args []string) error {
+	fs := flag.NewFlagSet("freeze", flag.ExitOnError)
+	output := fs.String("o", "", "write the Gomfile to this file, or stdout if -, instead of rewriting it")
+	fs.Parse(args)
+
+	if *gomFileName == "-" {
+		return errors.New("can't freeze a Gomfile read from stdin")
+	}
+	allGoms, err := parseGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	revs := make(map[string]string)
+	for _, gom := range allGoms {
+		rev, _, err := gom.vendoredState(vendor)
+		if err != nil {
+			return err
+		}
+		if rev == "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not installed, leaving its pin as it is\n", gom.name)
+			continue
+		}
+		revs[gom.name] = rev
+	}
+
+	src, err := ioutil.ReadFile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	frozen := freezeGomfile(src, revs)
+	switch *output {
+	case "-":
+		_, err = os.Stdout.Write(frozen)
+		return err
+	case "":
+		*output = *gomFileName
+	}
+	return ioutil.WriteFile(*output, frozen, 0644)
+}
+
+// freezeGomfile pins the goms declared in the Gomfile src to their commits
+// in revs. The first pin of a gom, which may be on a line continuing its
+// declaration, becomes the commit, and a gom without a pin gets the commit
+// after its name. Options that only go with a branch or a date, such as
+// track, are dropped, and so is a branch that came with a date.
+func freezeGomfile(src []byte, revs map[string]string) []byte {
+	lines := strings.SplitAfter(string(src), "\n")
+	code := func(i int) string {
+		return lines[i][:commentStart(lines[i])]
+	}
+	for i := 0; i < len(lines); i++ {
+		m := re_gom_name.FindStringSubmatchIndex(code(i))
+		if m == nil {
+			continue
+		}
+		// the declaration goes on while its lines end with a comma
+		last := i
+		for last+1 < len(lines) && strings.HasSuffix(strings.TrimSpace(code(last)), ",") {
+			last++
+		}
+		rev, ok := revs[unquote(lines[i][m[4]:m[5]])]
+		if !ok {
+			i = last
+			continue
+		}
+		pinned := false
+		for j := i; j <= last && !pinned; j++ {
+			c := code(j)
+			if loc := re_pin.FindStringSubmatchIndex(c); loc != nil {
+				lines[j] = c[:loc[0]] + ":commit" + c[loc[2]:loc[3]] + "'" + rev + "'" + lines[j][loc[1]:]
+				pinned = true
+			}
+		}
+		if !pinned {
+			lines[i] = lines[i][:m[1]] + ", :commit => '" + rev + "'" + lines[i][m[1]:]
+		}
+		unpin(lines, i, last)
+		i = last
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// unpin removes the options of re_unpinned from the declaration of a gom
+// on lines first to last, with their commas. A line left with nothing but
+// such an option is emptied, and when that option ended the declaration,
+// the comma before it goes as well.
+func unpin(lines []string, first, last int) {
+	for j := first; j <= last; j++ {
+		for {
+			c := lines[j][:commentStart(lines[j])]
+			loc := re_unpinned.FindStringSubmatchIndex(c)
+			if loc == nil {
+				break
+			}
+			lead, trail := loc[2] >= 0, loc[4] >= 0
+			keep := ""
+			if lead && trail {
+				keep = c[loc[4]:loc[5]]
+			}
+			lines[j] = c[:loc[0]] + keep + lines[j][loc[1]:]
+			if lead || strings.TrimSpace(lines[j][:commentStart(lines[j])]) != "" {
+				continue
+			}
+			if strings.TrimSpace(lines[j]) == "" {
+				lines[j] = ""
+			}
+			if !trail {
+				// the option ended the declaration
+				for k := j - 1; k >= first; k-- {
+					c := lines[k][:commentStart(lines[k])]
+					if comma := strings.LastIndex(c, ","); comma >= 0 {
+						lines[k] = c[:comma] + c[comma+1:] + lines[k][len(c):]
+						break
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFreezeGomfile(t *testing.T) {
+	src := `# pinned by hand
+gom 'github.com/mattn/go-runewidth', :tag => 'go1' # the last go1 release
+gom "github.com/mattn/go-gtk"
+gom 'github.com/mattn/go-sqlite3',
+    :branch => 'master',
+    :buildtags => 'icu'
+gom 'github.com/mattn/go-pointer', :branch => 'master'
+
+group :test do
+  gom 'github.com/mattn/go-colorable', :goos => 'windows', # :tag => 'v1'
+      :bookmark => 'stable'
+end
+`
+	revs := map[string]string{
+		"github.com/mattn/go-runewidth": "36e6bb1",
+		"github.com/mattn/go-gtk":       "0123abc",
+		"github.com/mattn/go-sqlite3":   "4567def",
+		"github.com/mattn/go-colorable": "89abcde",
+	}
+	expected := `# pinned by hand
+gom 'github.com/mattn/go-runewidth', :commit => '36e6bb1' # the last go1 release
+gom "github.com/mattn/go-gtk", :commit => '0123abc'
+gom 'github.com/mattn/go-sqlite3',
+    :commit => '4567def',
+    :buildtags => 'icu'
+gom 'github.com/mattn/go-pointer', :branch => 'master'
+
+group :test do
+  gom 'github.com/mattn/go-colorable', :goos => 'windows', # :tag => 'v1'
+      :commit => '89abcde'
+end
+`
+	if frozen := string(freezeGomfile([]byte(src), revs)); frozen != expected {
+		t.Fatalf("Expected %v, but %v:", expected, frozen)
+	}
+}
+
+func TestFreezeGomfileTrack(t *testing.T) {
+	src := `gom 'github.com/mattn/go-runewidth', :branch => 'master', :track => 'true'
+gom 'github.com/mattn/go-gtk', :track => 'true', :branch => 'master', :goos => 'linux'
+gom 'github.com/mattn/go-sqlite3', :branch => 'master', :track => 'true', :buildtags => 'icu'
+gom 'github.com/mattn/go-colorable',
+    :branch => 'master', # tip of master
+    :track => 'true'
+gom 'github.com/mattn/go-pointer',
+    :track => 'true',
+    :branch => 'master'
+`
+	revs := map[string]string{
+		"github.com/mattn/go-runewidth": "36e6bb1",
+		"github.com/mattn/go-gtk":       "0123abc",
+		"github.com/mattn/go-sqlite3":   "4567def",
+		"github.com/mattn/go-colorable": "89abcde",
+		"github.com/mattn/go-pointer":   "fedcba9",
+	}
+	expected := `gom 'github.com/mattn/go-runewidth', :commit => '36e6bb1'
+gom 'github.com/mattn/go-gtk', :commit => '0123abc', :goos => 'linux'
+gom 'github.com/mattn/go-sqlite3', :commit => '4567def', :buildtags => 'icu'
+gom 'github.com/mattn/go-colorable',
+    :commit => '89abcde' # tip of master
+gom 'github.com/mattn/go-pointer',
+    :commit => 'fedcba9'
+`
+	frozen := string(freezeGomfile([]byte(src), revs))
+	if frozen != expected {
+		t.Fatalf("Expected %v, but %v:", expected, frozen)
+	}
+	filename, err := tempGomfile(frozen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGoms(goms); err != nil {
+		t.Fatalf("Expected no error, but %v:", err)
+	}
+}
+
+func TestFreezeGomfileDate(t *testing.T) {
+	src := `gom 'github.com/mattn/go-runewidth', :date => '2016-03-01 12:00'
+gom 'github.com/mattn/go-sqlite3', :branch => 'master', :date => '2016-03-01', :buildtags => 'icu'
+gom 'github.com/mattn/go-gtk',
+    :date => '2016-03-01',
+    :branch => 'gtk3'
+`
+	revs := map[string]string{
+		"github.com/mattn/go-runewidth": "36e6bb1",
+		"github.com/mattn/go-sqlite3":   "4567def",
+		"github.com/mattn/go-gtk":       "0123abc",
+	}
+	expected := `gom 'github.com/mattn/go-runewidth', :commit => '36e6bb1'
+gom 'github.com/mattn/go-sqlite3', :commit => '4567def', :buildtags => 'icu'
+gom 'github.com/mattn/go-gtk',
+    :commit => '0123abc'
+`
+	frozen := string(freezeGomfile([]byte(src), revs))
+	if frozen != expected {
+		t.Fatalf("Expected %v, but %v:", expected, frozen)
+	}
+	filename, err := tempGomfile(frozen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateGoms(goms); err != nil {
+		t.Fatalf("Expected no error, but %v:", err)
+	}
+}
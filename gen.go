@@ -2,8 +2,9 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"go/build"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,29 +12,162 @@ import (
 )
 
 const travis_yml = ".travis.yml"
+const github_workflow = ".github/workflows/gom.yml"
+
+// runners maps the GOOS values CI can test on to the GitHub Actions runners
+// and the Travis CI os of that system.
+var runners = map[string][2]string{
+	"linux":   {"ubuntu-latest", "linux"},
+	"darwin":  {"macos-latest", "osx"},
+	"windows": {"windows-latest", "windows"},
+}
+
+// ciMatrix returns the systems and the groups of the goms in the Gomfile,
+// which a CI config tests each of. There is always linux, and no groups if
+// the Gomfile has none.
+func ciMatrix() (systems, groups []string, err error) {
+	systems = []string{"linux"}
+	if !isFile(*gomFileName) {
+		return systems, nil, nil
+	}
+	allGroups = true
+	goms, err := parseGomfile(*gomFileName)
+	allGroups = false
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, gom := range goms {
+		for _, goos := range optionValues(gom.options["goos"]) {
+			goos = strings.TrimPrefix(goos, "!")
+			if _, ok := runners[goos]; ok && !has(systems, goos) {
+				systems = append(systems, goos)
+			}
+		}
+		for _, group := range optionValues(gom.options["group"]) {
+			group = strings.TrimPrefix(group, "!")
+			if group != "" && !has(groups, group) {
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Strings(systems[1:])
+	sort.Strings(groups)
+	return systems, groups, nil
+}
+
+// createNew creates filename, and the directory it is in, unless it
+// already exists.
+func createNew(filename string) (*os.File, error) {
+	if _, err := os.Stat(filename); err == nil {
+		return nil, errors.New(filename + " already exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(filename)
+}
 
 func genTravisYml() error {
-	_, err := os.Stat(travis_yml)
-	if err == nil {
-		return errors.New(".travis.yml already exists")
+	systems, groups, err := ciMatrix()
+	if err != nil {
+		return err
 	}
-	f, err := os.Create(travis_yml)
+	f, err := createNew(travis_yml)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	f.WriteString(`language: go
+	writeTravisYml(f, systems, groups)
+	return nil
+}
+
+func writeTravisYml(w io.Writer, systems, groups []string) {
+	fmt.Fprint(w, `language: go
 go:
   - tip
-before_install:
+`)
+	if len(systems) > 1 {
+		fmt.Fprintln(w, "os:")
+		for _, goos := range systems {
+			fmt.Fprintf(w, "  - %s\n", runners[goos][1])
+		}
+	}
+	if len(groups) > 0 {
+		fmt.Fprintln(w, "env:")
+		for _, group := range groups {
+			fmt.Fprintf(w, "  - GOM_GROUPS=%s\n", group)
+		}
+	}
+	fmt.Fprint(w, `before_install:
   - go get github.com/mattn/gom
 script:
   - $HOME/gopath/bin/gom install
   - $HOME/gopath/bin/gom test
 `)
+}
+
+// genGithubActions writes a GitHub Actions workflow which installs the
+// goms and runs gom test on every system and for every group the Gomfile
+// names.
+func genGithubActions(args []string) error {
+	fs := flag.NewFlagSet("gen github-actions", flag.ExitOnError)
+	output := fs.String("o", github_workflow, "write the workflow to this file, or stdout if -")
+	fs.Parse(args)
+
+	systems, groups, err := ciMatrix()
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		writeGithubActions(os.Stdout, systems, groups)
+		return nil
+	}
+	f, err := createNew(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writeGithubActions(f, systems, groups)
 	return nil
 }
 
+func writeGithubActions(w io.Writer, systems, groups []string) {
+	var oses []string
+	for _, goos := range systems {
+		oses = append(oses, runners[goos][0])
+	}
+	fmt.Fprintf(w, `name: gom
+on: [push, pull_request]
+jobs:
+  test:
+    strategy:
+      fail-fast: false
+      matrix:
+        os: [%s]
+`, strings.Join(oses, ", "))
+	if len(groups) > 0 {
+		fmt.Fprintf(w, "        groups: [%s]\n", strings.Join(groups, ", "))
+	}
+	// gom works in GOPATH mode, which go1.16 still has with GO111MODULE=off
+	fmt.Fprint(w, `    runs-on: ${{ matrix.os }}
+    env:
+      GO111MODULE: 'off'
+`)
+	if len(groups) > 0 {
+		fmt.Fprint(w, `      GOM_GROUPS: ${{ matrix.groups }}
+`)
+	}
+	fmt.Fprint(w, `    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.16'
+      - run: go get github.com/mistsys/gom
+      - run: gom install
+      - run: gom test
+`)
+}
+
 // http://code.google.com/p/go/source/browse/src/cmd/go/pkg.go?name=go1.1.2#96
 func isStandardImport(path string) bool {
 	return !strings.Contains(path, ".")
@@ -48,67 +182,73 @@ func appendPkg(pkgs []string, pkg string) []string {
 	return append(pkgs, pkg)
 }
 
-func appendPkgs(pkgs, more []string) []string {
-	for _, pkg := range more {
-		pkgs = appendPkg(pkgs, pkg)
-	}
-	return pkgs
-}
+// genGomfile writes a Gomfile listing the packages outside the standard
+// library that the packages below the current directory depend on. Those
+// found in GOPATH are pinned to the commit they are at.
+func genGomfile(args []string) error {
+	fs := flag.NewFlagSet("gen gomfile", flag.ExitOnError)
+	output := fs.String("o", "", "write the Gomfile to this file instead of stdout")
+	fs.Parse(args)
 
-func scanDirectory(path, srcDir string) (ret []string, err error) {
-	pkg, err := build.Import(path, srcDir, build.AllowBinary)
-	if err != nil {
-		return ret, err
-	}
-
-	for _, imp := range pkg.Imports {
-		switch {
-		case isStandardImport(imp):
-			// Ignore standard packages
-		case !build.IsLocalImport(imp):
-			// Add the external package
-			ret = appendPkg(ret, imp)
-			fallthrough
-		default:
-			// Does the recursive walk
-			pkgs, err := scanDirectory(imp, pkg.Dir)
-			if err != nil {
-				return ret, err
-			}
-			ret = appendPkgs(ret, pkgs)
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := createNew(*output)
+		if err != nil {
+			return err
 		}
+		defer f.Close()
+		w = f
 	}
 
-	return ret, err
-}
-
-func genGomfile() error {
-	_, err := os.Stat(*gomFileName)
-	if err == nil {
-		return errors.New(*gomFileName + " already exists")
-	}
-	f, err := os.Create(*gomFileName)
+	own, err := ownImportPath()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	dir, err := os.Getwd()
+	out, err := goList(nil, "-e", "-deps", "-f", `{{if not .Standard}}{{.ImportPath}}{{"\t"}}{{.Dir}}{{end}}`, "./...")
 	if err != nil {
 		return err
 	}
-	all, err := scanDirectory(".", dir)
-	if err != nil {
-		return err
+	var pkgs []string
+	dirs := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 || isOwnPackage(own, fields[0]) {
+			continue
+		}
+		pkgs = appendPkg(pkgs, fields[0])
+		dirs[fields[0]] = fields[1]
 	}
-	sort.Strings(all)
-	for _, pkg := range all {
-		fmt.Fprintf(f, "gom '%s'\n", pkg)
+	sort.Strings(pkgs)
+
+	revs := make(map[string]string) // by repository root
+	for _, pkg := range pkgs {
+		rev := ""
+		if dir := dirs[pkg]; dir != "" {
+			src := strings.TrimSuffix(dir, filepath.FromSlash(pkg))
+			if p, vcs := findVCS(src, pkg); vcs != nil {
+				if _, ok := revs[p]; !ok {
+					revs[p], _ = vcs.Revision(p)
+				}
+				rev = revs[p]
+			}
+		}
+		if rev != "" {
+			fmt.Fprintf(w, "gom '%s', :commit => '%s'\n", pkg, rev)
+		} else {
+			fmt.Fprintf(w, "gom '%s'\n", pkg)
+		}
 	}
 	return nil
 }
 
-func genGomfileLock() error {
+func genGomfileLock(args []string) error {
+	fs := flag.NewFlagSet("lock", flag.ExitOnError)
+	hash := fs.Bool("hash", false, "record the SHA-256 of the sources of every package")
+	fs.Parse(args)
+
+	if *gomFileName == "-" {
+		return errors.New("can't lock a Gomfile read from stdin")
+	}
 	allGoms, err := parseGomfile(*gomFileName)
 	if err != nil {
 		return err
@@ -117,38 +257,42 @@ func genGomfileLock() error {
 	if err != nil {
 		return err
 	}
-	goms := make([]Gom, 0)
-	for _, gom := range allGoms {
-		if group, ok := gom.options["group"]; ok {
-			if !matchEnv(group) {
-				continue
-			}
-		}
-		if goos, ok := gom.options["goos"]; ok {
-			if !matchOS(goos) {
-				continue
-			}
-		}
-		goms = append(goms, gom)
+	// every vendored repository of a glob gom is locked by itself
+	allGoms, err = expandGlobs(allGoms, vendoredRepositories(vendor))
+	if err != nil {
+		return err
 	}
+	goms := filterGoms(allGoms)
 
 	for _, gom := range goms {
-		var vcs *vcsCmd
-		p := filepath.Join(vendorSrc(vendor), gom.name)
-		if isDir(filepath.Join(p, ".git")) {
-			vcs = git
-		} else if isDir(filepath.Join(p, ".hg")) {
-			vcs = hg
-		} else if isDir(filepath.Join(p, ".bzr")) {
-			vcs = bzr
-		}
-		if vcs != nil {
-			rev, err := vcs.Revision(p)
+		if gom.module() {
+			// the resolved version, which go mod download takes as well
+			if version := vendoredModuleVersion(gom.cacheSrcDir(vendor)); version != "" {
+				gom.options["commit"] = version
+			}
+		} else if p, vcs := gom.findVCS(vendorSrc(vendor)); vcs != nil {
+			rev, err := gom.revisionAt(vcs, p)
 			if err == nil && rev != "" {
 				gom.options["commit"] = rev
 			}
 
 		}
+		if *hash {
+			if has(gom.options, "post_install") {
+				// the hook changed the sources after they were checked
+				fmt.Printf("Warning: not hashing %s, since its post_install may change its sources\n", gom.name)
+				delete(gom.options, "sha256")
+				continue
+			}
+			if !isDir(gom.cacheSrcDir(vendor)) {
+				return fmt.Errorf("%s is not in %s; install it before hashing it", gom.name, vendorFolder)
+			}
+			sum, err := treeHash(gom.cacheSrcDir(vendor))
+			if err != nil {
+				return err
+			}
+			gom.options["sha256"] = sum
+		}
 	}
 	f, err := os.Create(*gomFileName + ".lock")
 	if err != nil {
@@ -156,11 +300,18 @@ func genGomfileLock() error {
 	}
 	defer f.Close()
 	for _, gom := range goms {
-		if rev, ok := gom.options["commit"]; ok {
-			fmt.Fprintf(f, "gom '%s', :commit => '%s'\n", gom.name, rev.(string))
-		} else {
-			fmt.Fprintf(f, "gom '%s'\n", gom.name)
+		fmt.Fprintf(f, "gom '%s'", gom.name)
+		if rev, ok := gom.options["commit"].(string); ok {
+			fmt.Fprintf(f, ", :commit => '%s'", rev)
+			if tag, ok := gom.options["tag"].(string); ok {
+				// keep the tag, so that verify can tell when it moves
+				fmt.Fprintf(f, ", :tag => '%s'", tag)
+			}
+		}
+		if sum, ok := gom.options["sha256"].(string); ok {
+			fmt.Fprintf(f, ", :sha256 => '%s'", sum)
 		}
+		fmt.Fprintln(f)
 	}
 	fmt.Println(*gomFileName + ".lock is generated")
 	return nil
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenGomfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src", "example.com")
+	dep := filepath.Join(src, "dep")
+	gitRepo(t, dep, map[string]string{"dep.go": "package dep\n"})
+	commit := gitOutput(t, dep, "rev-parse", "HEAD")
+	files := map[string]string{
+		filepath.Join(src, "nogit", "nogit.go"): `package nogit`,
+		filepath.Join(src, "proj", "main.go"): `package main
+import (
+	_ "example.com/dep"
+	_ "example.com/nogit"
+	_ "example.com/proj/sub"
+	_ "fmt"
+)
+func main() {}`,
+		filepath.Join(src, "proj", "sub", "sub.go"): `package sub`,
+	}
+	for p, content := range files {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(filepath.Join(src, "proj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	output := filepath.Join(dir, "Gomfile")
+	err = genGomfile([]string{"-o", output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "gom 'example.com/dep', :commit => '" + commit + "'\n" +
+		"gom 'example.com/nogit'\n"
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+
+	err = genGomfile([]string{"-o", output})
+	if err == nil {
+		t.Fatalf("Expected %v, but %v:", "an error", err)
+	}
+}
+
+func TestCIMatrix(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-runewidth'
+gom 'github.com/mattn/go-ole', :goos => 'windows'
+gom 'github.com/mattn/go-colorable', :goos => '!darwin', :group => 'integration'
+gom 'github.com/mattn/go-plan9', :goos => 'plan9'
+group :test, :!production do
+    gom 'github.com/mattn/go-sqlite3'
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	defer func(name string) { *gomFileName = name }(*gomFileName)
+	*gomFileName = filename
+
+	systems, groups, err := ciMatrix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"linux", "darwin", "windows"}
+	if !reflect.DeepEqual(systems, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, systems)
+	}
+	expected = []string{"integration", "production", "test"}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, groups)
+	}
+	if allGroups {
+		t.Fatalf("Expected allGroups to be reset")
+	}
+}
+
+func TestWriteGithubActions(t *testing.T) {
+	var buf bytes.Buffer
+	writeGithubActions(&buf, []string{"linux", "darwin"}, []string{"test"})
+	expected := `name: gom
+on: [push, pull_request]
+jobs:
+  test:
+    strategy:
+      fail-fast: false
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+        groups: [test]
+    runs-on: ${{ matrix.os }}
+    env:
+      GO111MODULE: 'off'
+      GOM_GROUPS: ${{ matrix.groups }}
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.16'
+      - run: go get github.com/mistsys/gom
+      - run: gom install
+      - run: gom test
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+
+	buf.Reset()
+	writeGithubActions(&buf, []string{"linux"}, nil)
+	expected = `name: gom
+on: [push, pull_request]
+jobs:
+  test:
+    strategy:
+      fail-fast: false
+      matrix:
+        os: [ubuntu-latest]
+    runs-on: ${{ matrix.os }}
+    env:
+      GO111MODULE: 'off'
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: '1.16'
+      - run: go get github.com/mistsys/gom
+      - run: gom install
+      - run: gom test
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+
+	buf.Reset()
+	writeTravisYml(&buf, []string{"linux"}, nil)
+	expected = `language: go
+go:
+  - tip
+before_install:
+  - go get github.com/mattn/gom
+script:
+  - $HOME/gopath/bin/gom install
+  - $HOME/gopath/bin/gom test
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+}
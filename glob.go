@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// re_glob matches the import paths of glob goms: a host and an owner, or
+// with GitLab a group and its subgroups, followed by /...
+var re_glob = regexp.MustCompile(`^[^/]+(/[^/.][^/]*)+/\.\.\.$`)
+
+// The APIs the repositories of a glob gom are listed with.
+var (
+	githubAPI = "https://api.github.com"
+	gitlabAPI = "https://gitlab.com/api/v4"
+)
+
+// globHosts lists the repositories of owner, by their paths on the host,
+// for every host glob goms may be on.
+var globHosts = map[string]func(gom *Gom, owner string) ([]string, error){
+	"github.com": listGitHub,
+	"gitlab.com": listGitLab,
+}
+
+// globbed reports whether gom is a glob gom, which stands for every
+// repository of an owner.
+func (gom *Gom) globbed() bool {
+	glob, _ := gom.options["glob"].(string)
+	return glob == "true"
+}
+
+// globPrefix returns the host and the owner of the glob gom.
+func (gom *Gom) globPrefix() (host, owner string) {
+	prefix := strings.TrimSuffix(gom.name, "/...")
+	i := strings.Index(prefix, "/")
+	return prefix[:i], prefix[i+1:]
+}
+
+// expandGlobs replaces every glob gom with a gom for each of the import
+// paths list returns for it, with the same options. Goms the Gomfile lists
+// by themselves keep their own options.
+func expandGlobs(goms []Gom, list func(gom *Gom) ([]string, error)) ([]Gom, error) {
+	listed := make(map[string]bool)
+	for _, gom := range goms {
+		listed[gom.name] = true
+	}
+	var expanded []Gom
+	for _, gom := range goms {
+		if !gom.globbed() {
+			expanded = append(expanded, gom)
+			continue
+		}
+		names, err := list(&gom)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if listed[name] {
+				continue
+			}
+			listed[name] = true
+			options := make(map[string]interface{}, len(gom.options))
+			for key, value := range gom.options {
+				if key != "glob" {
+					options[key] = value
+				}
+			}
+			expanded = append(expanded, Gom{name: name, options: options})
+		}
+	}
+	return expanded, nil
+}
+
+// listRepositories returns the import paths of the repositories the host
+// API of the glob gom lists for its owner.
+func listRepositories(gom *Gom) ([]string, error) {
+	host, owner := gom.globPrefix()
+	list, ok := globHosts[host]
+	if !ok {
+		return nil, fmt.Errorf("%s: can't list the repositories on %s; :glob supports github.com and gitlab.com", gom.name, host)
+	}
+	repos, err := list(gom, owner)
+	if err != nil {
+		return nil, fmt.Errorf("%s: can't list the repositories of %s: %v", gom.name, owner, err)
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("%s: %s has no repositories", gom.name, owner)
+	}
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = host + "/" + repo
+	}
+	sort.Strings(names)
+	fmt.Printf("%s expands to %d packages\n", gom.name, len(names))
+	return names, nil
+}
+
+// vendoredRepositories returns a lister of the import paths of the
+// checkouts already vendored under the owner of a glob gom, for when the
+// host isn't asked.
+func vendoredRepositories(vendor string) func(gom *Gom) ([]string, error) {
+	return func(gom *Gom) ([]string, error) {
+		src := vendorSrc(vendor)
+		root := filepath.Join(src, filepath.FromSlash(strings.TrimSuffix(gom.name, "/...")))
+		var names []string
+		err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !fi.IsDir() || p == root {
+				return nil
+			}
+			if vcsForDir(p) != nil {
+				rel, err := filepath.Rel(src, p)
+				if err != nil {
+					return err
+				}
+				names = append(names, filepath.ToSlash(rel))
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		return names, err
+	}
+}
+
+// listGitHub lists the repositories of the GitHub organization or user
+// owner, page by page.
+func listGitHub(gom *Gom, owner string) ([]string, error) {
+	var names []string
+	for _, kind := range []string{"orgs", "users"} {
+		for page := 1; ; page++ {
+			var repos []struct {
+				FullName string `json:"full_name"`
+			}
+			u := fmt.Sprintf("%s/%s/%s/repos?per_page=100&page=%d", githubAPI, kind, url.PathEscape(owner), page)
+			found, err := gom.getJSON(u, "Authorization", "token ", &repos)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				// not an organization; a user then
+				break
+			}
+			if len(repos) == 0 {
+				return names, nil
+			}
+			for _, repo := range repos {
+				names = append(names, repo.FullName)
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s is neither an organization nor a user on GitHub", owner)
+}
+
+// listGitLab lists the projects of the GitLab group owner and of its
+// subgroups, page by page.
+func listGitLab(gom *Gom, owner string) ([]string, error) {
+	var names []string
+	for page := 1; ; page++ {
+		var projects []struct {
+			Path string `json:"path_with_namespace"`
+		}
+		u := fmt.Sprintf("%s/groups/%s/projects?include_subgroups=true&per_page=100&page=%d", gitlabAPI, url.PathEscape(owner), page)
+		found, err := gom.getJSON(u, "PRIVATE-TOKEN", "", &projects)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is not a group on GitLab", owner)
+		}
+		if len(projects) == 0 {
+			return names, nil
+		}
+		for _, project := range projects {
+			names = append(names, project.Path)
+		}
+	}
+}
+
+// getJSON gets u and decodes its JSON into v. The token of gom, if it has
+// one, goes in the header auth after prefix, and its proxy is used. It
+// reports false if there is nothing at u.
+func (gom *Gom) getJSON(u, auth, prefix string, v interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(rootCtx, "GET", u, nil)
+	if err != nil {
+		return false, err
+	}
+	name, ok := gom.options["token_env"].(string)
+	if !ok {
+		name = "GOM_GIT_TOKEN"
+	}
+	if token := os.Getenv(name); token != "" {
+		addSecret(token)
+		req.Header.Set(auth, prefix+token)
+	}
+	transport := http.DefaultTransport
+	if proxy, ok := gom.options["proxy"].(string); ok {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return false, err
+		}
+		transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	}
+	if *verbose {
+		fmt.Println(redact("GET " + u))
+	}
+	client := &http.Client{Transport: transport, Timeout: *timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return false, fmt.Errorf("GET %s: %v", u, err)
+	}
+	return true, nil
+}
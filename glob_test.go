@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandGlobs(t *testing.T) {
+	goms := []Gom{
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1.0"}},
+		{name: "github.com/mattn/...", options: map[string]interface{}{"glob": "true", "branch": "master"}},
+		{name: "github.com/daviddengcn/go-colortext", options: map[string]interface{}{}},
+	}
+	list := func(gom *Gom) ([]string, error) {
+		return []string{"github.com/mattn/go-gtk", "github.com/mattn/go-runewidth"}, nil
+	}
+	expanded, err := expandGlobs(goms, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1.0"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"branch": "master"}},
+		{name: "github.com/daviddengcn/go-colortext", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, expanded)
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		switch {
+		case r.URL.Path == "/orgs/mattn/repos":
+			http.NotFound(w, r)
+		case r.URL.Path == "/users/mattn/repos" && page == "1":
+			fmt.Fprint(w, `[{"full_name": "mattn/go-runewidth"}, {"full_name": "mattn/go-gtk"}]`)
+		case r.URL.Path == "/groups/team/sub/projects" && page == "1":
+			fmt.Fprint(w, `[{"path_with_namespace": "team/sub/tool"}]`)
+		case r.URL.Path == "/orgs/broken/repos":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+	defer func(github, gitlab string) { githubAPI, gitlabAPI = github, gitlab }(githubAPI, gitlabAPI)
+	githubAPI, gitlabAPI = server.URL, server.URL
+
+	tests := []struct {
+		name     string
+		expected []string
+		err      string
+	}{
+		{"github.com/mattn/...", []string{"github.com/mattn/go-gtk", "github.com/mattn/go-runewidth"}, ""},
+		{"gitlab.com/team/sub/...", []string{"gitlab.com/team/sub/tool"}, ""},
+		{"github.com/broken/...", nil, "github.com/broken/...: can't list the repositories of broken: GET " + server.URL + "/orgs/broken/repos?per_page=100&page=1: 500 Internal Server Error"},
+		{"github.com/empty/...", nil, "github.com/empty/...: empty has no repositories"},
+		{"example.com/team/...", nil, "example.com/team/...: can't list the repositories on example.com; :glob supports github.com and gitlab.com"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: test.name, options: map[string]interface{}{"glob": "true"}}
+		names, err := listRepositories(&gom)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("Expected %v, but %v:", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, names)
+		}
+	}
+}
+
+func TestVendoredRepositories(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+	for _, dir := range []string{"github.com/mattn/go-gtk/.git", "github.com/mattn/go-gtk/gtk", "github.com/mattn/docs"} {
+		if err := os.MkdirAll(filepath.Join(vendorSrc(vendor), filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gom := Gom{name: "github.com/mattn/...", options: map[string]interface{}{"glob": "true"}}
+	names, err := vendoredRepositories(vendor)(&gom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"github.com/mattn/go-gtk"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, names)
+	}
+}
@@ -2,20 +2,30 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 var qx = `'[^']*'|"[^"]*"`
 var kx = `:[a-z][a-z0-9_]*`
-var ax = `(?:\s*` + kx + `\s*|,\s*` + kx + `\s*)`
-var re_group = regexp.MustCompile(`\s*group\s+((?:` + kx + `\s*|,\s*` + kx + `\s*)*)\s*do\s*$`)
+var sx = `:!?[a-z0-9_]+`
+var ax = `(?:\s*` + sx + `\s*|,\s*` + sx + `\s*)`
+var re_group = regexp.MustCompile(`\s*group\s+((?:` + sx + `\s*|,\s*` + sx + `\s*)*)\s*do\s*$`)
 var re_end = regexp.MustCompile(`\s*end\s*$`)
 var re_gom = regexp.MustCompile(`^\s*gom\s+(` + qx + `)\s*((?:,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*))*)$`)
+var re_gom_json = regexp.MustCompile(`^\s*gom\s+(` + qx + `)\s*(\{.*\})\s*$`)
+var re_include = regexp.MustCompile(`^\s*include\s+(` + qx + `)\s*$`)
 var re_options = regexp.MustCompile(`(,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*)\s*)`)
 
 func unquote(name string) string {
@@ -28,47 +38,84 @@ func unquote(name string) string {
 	return name
 }
 
-func matchOS(any interface{}) bool {
-	var envs []string
-	switch a := any.(type) {
-	case []string:
-		envs = a
-	case string:
-		envs = []string{a}
-	default:
+// matchValues reports whether the values of a goos, goarch or group
+// option select what match accepts. A value may be a list, or a string of
+// comma-separated values. Values with a leading "!" exclude what they name:
+// at least one of the other values has to match, if there are any, and
+// none of the excluded ones may.
+func matchValues(any interface{}, match func(string) bool) bool {
+	values := optionValues(any)
+	if len(values) == 0 {
 		return false
 	}
 
-	return has(envs, runtime.GOOS)
+	included, matched := false, false
+	for _, v := range values {
+		if strings.HasPrefix(v, "!") {
+			if match(v[1:]) {
+				return false
+			}
+			continue
+		}
+		included = true
+		if match(v) {
+			matched = true
+		}
+	}
+	return matched || !included
 }
 
-func matchEnv(any interface{}) bool {
-	var envs []string
+// optionValues returns the values of an option that is a list, or a string
+// of comma-separated values.
+func optionValues(any interface{}) []string {
+	var values []string
 	switch a := any.(type) {
 	case []string:
-		envs = a
+		values = append(values, a...)
 	case string:
-		envs = []string{a}
-	default:
-		return false
+		values = strings.Split(a, ",")
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
 	}
+	return values
+}
+
+func matchOS(any interface{}) bool {
+	return matchValues(any, func(goos string) bool {
+		return goos == runtime.GOOS
+	})
+}
 
-	switch {
-	case *productionEnv && has(envs, "production"):
-		return true
-	case *developmentEnv && has(envs, "development"):
-		return true
-	case *testEnv && has(envs, "test"):
-		return true
+func matchArch(any interface{}) bool {
+	goarch := os.Getenv("GOARCH")
+	if goarch == "" {
+		goarch = runtime.GOARCH
 	}
+	return matchValues(any, func(arch string) bool {
+		return arch == goarch
+	})
+}
 
-	for _, g := range customGroupList {
-		if has(envs, g) {
-			return true
+// matchEnv reports whether the groups in any are selected. A group that
+// is left out with -without never is.
+func matchEnv(any interface{}) bool {
+	for _, g := range optionValues(any) {
+		if has(withoutGroupList, g) {
+			return false
 		}
 	}
-
-	return false
+	return matchValues(any, func(env string) bool {
+		switch {
+		case *productionEnv && env == "production":
+			return true
+		case *developmentEnv && env == "development":
+			return true
+		case *testEnv && env == "test":
+			return true
+		}
+		return has(customGroupList, env)
+	})
 }
 
 func parseOptions(line string, options map[string]interface{}) {
@@ -97,26 +144,435 @@ func parseOptions(line string, options map[string]interface{}) {
 	}
 }
 
+// parseJSONOptions parses options given as a JSON object, which is easier
+// to emit than the Ruby-like form. A value is a string, a number, a boolean
+// or a list of strings, like :group => [:test] is ["test"].
+func parseJSONOptions(obj string, options map[string]interface{}) error {
+	d := json.NewDecoder(strings.NewReader(obj))
+	d.UseNumber()
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		return err
+	}
+	if d.More() {
+		return fmt.Errorf("more than one object")
+	}
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			options[k] = v
+		case json.Number:
+			options[k] = v.String()
+		case bool:
+			options[k] = strconv.FormatBool(v)
+		case []interface{}:
+			a := []string{}
+			for _, it := range v {
+				s, ok := it.(string)
+				if !ok {
+					return fmt.Errorf("option %s must be a list of strings", k)
+				}
+				a = append(a, s)
+			}
+			options[k] = a
+		default:
+			return fmt.Errorf("option %s must be a string, a number, a boolean or a list", k)
+		}
+	}
+	return nil
+}
+
+// onlyGoms returns the goms named in names. It fails if allGoms doesn't
+// list one of them, or the groups leave it out of goms.
+func onlyGoms(allGoms, goms []Gom, names []string) ([]Gom, error) {
+	var only []Gom
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		found := false
+		for _, gom := range goms {
+			if gom.name == name {
+				only = append(only, gom)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		for _, gom := range allGoms {
+			if gom.name == name {
+				return nil, fmt.Errorf("%s is left out by the selected groups", name)
+			}
+		}
+		return nil, fmt.Errorf("%s is not in %s", name, *gomFileName)
+	}
+	return only, nil
+}
+
+// filterGoms returns the goms that belong to the selected groups and
+// target the current GOOS and GOARCH.
+func filterGoms(allGoms []Gom) []Gom {
+	goms := make([]Gom, 0)
+	for _, gom := range allGoms {
+		if group, ok := gom.options["group"]; ok {
+			if !matchEnv(group) {
+				continue
+			}
+		}
+		if goos, ok := gom.options["goos"]; ok {
+			if !matchOS(goos) {
+				continue
+			}
+		}
+		if goarch, ok := gom.options["goarch"]; ok {
+			if !matchArch(goarch) {
+				continue
+			}
+		}
+		goms = append(goms, gom)
+	}
+	return goms
+}
+
+// knownOptions lists the options a gom may have.
+var knownOptions = map[string]bool{
+	"bookmark":     true,
+	"branch":       true,
+	"buildtags":    true,
+	"command":      true,
+	"commit":       true,
+	"date":         true,
+	"depth":        true,
+	"env":          true,
+	"gcflags":      true,
+	"glob":         true,
+	"go":           true,
+	"goarch":       true,
+	"goos":         true,
+	"group":        true,
+	"insecure":     true,
+	"ldflags":      true,
+	"lfs":          true,
+	"mirror":       true,
+	"module":       true,
+	"netrc":        true,
+	"packages":     true,
+	"post_install": true,
+	"private":      true,
+	"proxy":        true,
+	"recursive":    true,
+	"remote":       true,
+	"repo_root":    true,
+	"retries":      true,
+	"revno":        true,
+	"scheme":       true,
+	"sha256":       true,
+	"shallow":      true,
+	"since":        true,
+	"skipdep":      true,
+	"ssh_host":     true,
+	"strip_tests":  true,
+	"tag":          true,
+	"target":       true,
+	"token_env":    true,
+	"track":        true,
+	"vcs":          true,
+}
+
+// exclusiveOptions lists sets of options of which a gom may have only one.
+var exclusiveOptions = [][]string{
+	{"commit", "tag", "branch", "bookmark"},
+	{"date", "commit", "tag", "bookmark"},
+	{"date", "track"},
+	{"command", "private", "shallow"},
+	{"command", "depth", "since"},
+	{"command", "mirror"},
+	{"module", "command", "private", "shallow", "mirror", "depth", "since"},
+	{"glob", "commit"},
+	{"glob", "sha256"},
+	{"glob", "target"},
+	{"glob", "repo_root"},
+	{"sha256", "strip_tests"},
+}
+
+// validateGoms rejects unknown options and conflicting combinations of
+// options, which would otherwise be silently ignored.
+func validateGoms(goms []Gom) error {
+	for _, gom := range goms {
+		keys := make([]string, 0, len(gom.options))
+		for key := range gom.options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !knownOptions[key] {
+				return fmt.Errorf("%s: unknown option :%s", gom.name, key)
+			}
+		}
+		for _, exclusive := range exclusiveOptions {
+			var found []string
+			for _, key := range exclusive {
+				if has(gom.options, key) {
+					found = append(found, key)
+				}
+			}
+			if len(found) > 1 {
+				return fmt.Errorf("%s: options :%s and :%s can't be used together", gom.name, found[0], found[1])
+			}
+		}
+		if depth, ok := gom.options["depth"].(string); has(gom.options, "depth") && (!ok || !isPositive(depth)) {
+			return fmt.Errorf("%s: option :depth must be a positive number", gom.name)
+		}
+		if n, ok := gom.options["retries"].(string); has(gom.options, "retries") && (!ok || (n != "0" && !isPositive(n))) {
+			return fmt.Errorf("%s: option :retries must be a number", gom.name)
+		}
+		if root, ok := gom.options["repo_root"].(string); has(gom.options, "repo_root") && (!ok || (root != gom.name && !strings.HasPrefix(gom.name, root+"/"))) {
+			return fmt.Errorf("%s: option :repo_root must be the import path or one of its parents", gom.name)
+		}
+		if tag, ok := gom.options["tag"].(string); ok && isTagPattern(tag) {
+			if _, err := path.Match(tag, ""); err != nil {
+				return fmt.Errorf("%s: option :tag is an invalid pattern: %v", gom.name, err)
+			}
+		}
+		if v, ok := gom.options["go"].(string); has(gom.options, "go") && (!ok || (!re_toolchain.MatchString(v) && !filepath.IsAbs(v))) {
+			return fmt.Errorf("%s: option :go must be a Go release like go1.19 or the absolute path of a go command", gom.name)
+		}
+		if sum, ok := gom.options["sha256"].(string); has(gom.options, "sha256") && (!ok || !re_sha256.MatchString(sum)) {
+			return fmt.Errorf("%s: option :sha256 must be 64 lowercase hex digits", gom.name)
+		}
+		if name, ok := gom.options["vcs"].(string); has(gom.options, "vcs") && (!ok || vcsByName[name] == nil) {
+			return fmt.Errorf("%s: option :vcs must be one of bzr, darcs, fossil, git, hg or svn", gom.name)
+		}
+		if gom.globbed() && !re_glob.MatchString(gom.name) {
+			return fmt.Errorf("%s: option :glob needs an import path like github.com/org/...", gom.name)
+		}
+		if gom.tracks() && !has(gom.options, "branch") {
+			return fmt.Errorf("%s: option :track needs a :branch", gom.name)
+		}
+	}
+	return nil
+}
+
+func isPositive(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
+
 type Gom struct {
 	name    string
 	options map[string]interface{}
+
+	// index is the position of the gom among the total goms being
+	// installed, counting from 1, or 0 outside of an install.
+	index, total int
+
+	// unchanged is set when the last install left the gom as this one
+	// would, so that it is neither fetched, checked out nor built again.
+	unchanged bool
+}
+
+// Target returns the import path gom is vendored as, its target option or
+// else its name, with its . and .. elements collapsed.
+func (gom *Gom) Target() string {
+	if target, ok := gom.options["target"].(string); ok {
+		return path.Clean(target)
+	}
+	return path.Clean(gom.name)
+}
+
+// inVendor reports whether the import path p stays below the directory it
+// is joined to, such as vendor/src, once its . and .. elements are
+// collapsed. A Gomfile could otherwise write anywhere.
+func inVendor(p string) bool {
+	if p == "" || path.IsAbs(p) || filepath.IsAbs(p) {
+		return false
+	}
+	p = path.Clean(filepath.ToSlash(p))
+	return p != "." && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+// progress returns the "[i/N] " prefix of the lines printed while gom is
+// installed.
+func (gom *Gom) progress() string {
+	if gom.index == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d] ", gom.index, gom.total)
+}
+
+// loadGomfile parses filename and, when filename.lock exists, pins every
+// locked gom to the commit recorded for it in place of its branch, tag or
+// bookmark, together with the hash of its sources if one was recorded.
+// Goms that track their branch are never pinned, and neither are goms
+// whose tag differs from the one the lock file recorded with the commit.
+// A Gomfile read from stdin has no lock file.
+func loadGomfile(filename string) ([]Gom, error) {
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return goms, lockGoms(filename, goms)
+}
+
+// lockGoms pins goms to filename.lock as loadGomfile does. Goms it already
+// pinned stay as they are.
+func lockGoms(filename string, goms []Gom) error {
+	if filename == "-" || !isFile(filename+".lock") {
+		return nil
+	}
+	locked, err := parseGomfile(filename + ".lock")
+	if err != nil {
+		return err
+	}
+	commits := make(map[string]string)
+	tags := make(map[string]string)
+	sums := make(map[string]string)
+	for _, gom := range locked {
+		if commit, ok := gom.options["commit"].(string); ok {
+			commits[gom.name] = commit
+		}
+		if tag, ok := gom.options["tag"].(string); ok {
+			tags[gom.name] = tag
+		}
+		if sum, ok := gom.options["sha256"].(string); ok {
+			sums[gom.name] = sum
+		}
+	}
+	for _, gom := range goms {
+		if lockedTag, ok := tags[gom.name]; ok && gom.options["tag"] != lockedTag {
+			// the Gomfile moved to another tag since it was locked
+			continue
+		}
+		if commit, ok := commits[gom.name]; ok && !gom.tracks() {
+			delete(gom.options, "branch")
+			delete(gom.options, "bookmark")
+			delete(gom.options, "tag")
+			delete(gom.options, "date")
+			gom.options["commit"] = commit
+			if sum, ok := sums[gom.name]; ok {
+				gom.options["sha256"] = sum
+			}
+		}
+	}
+	return nil
+}
+
+// mergeGoms adds more to goms. A gom that is already in goms keeps its
+// position but takes the options of the later entry, so that an included
+// Gomfile can be overridden.
+func mergeGoms(goms []Gom, more ...Gom) []Gom {
+	for _, gom := range more {
+		found := false
+		for i := range goms {
+			if goms[i].name == gom.name {
+				goms[i].options = gom.options
+				found = true
+				break
+			}
+		}
+		if !found {
+			goms = append(goms, gom)
+		}
+	}
+	return goms
+}
+
+// allGroups makes parseGomfile keep the goms of every group block, with the
+// groups of the block as their group option.
+var allGroups bool
+
+var stdinGomfile []byte
+var stdinRead bool
+
+// readStdinGomfile reads the whole Gomfile from stdin the first time it is
+// called, so that the Gomfile can be parsed more than once.
+func readStdinGomfile() ([]byte, error) {
+	if !stdinRead {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdinGomfile, stdinRead = b, true
+	}
+	return stdinGomfile, nil
+}
+
+// stripComment removes a # comment, which isn't inside quotes, and the
+// surrounding spaces from line.
+func stripComment(line string) string {
+	return strings.TrimSpace(line[:commentStart(line)])
+}
+
+// commentStart returns the index of the # starting the comment of line,
+// or the length of line if it has none. A # in a quoted string doesn't
+// start a comment.
+func commentStart(line string) int {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '#':
+			return i
+		}
+	}
+	return len(line)
+}
+
+func syntaxError(filename string, n int, line string) error {
+	if filename == "-" {
+		filename = "stdin"
+	}
+	return fmt.Errorf("Syntax Error at line %d of %s: %s", n, filename, line)
 }
 
 func parseGomfile(filename string) ([]Gom, error) {
-	f, err := os.Open(filename + ".lock")
+	return parseGomfileIncludes(filename, make(map[string]bool))
+}
+
+// parseGomfileIncludes parses filename and the Gomfiles it includes.
+// including holds the files being parsed, to detect include cycles.
+func parseGomfileIncludes(filename string, including map[string]bool) ([]Gom, error) {
+	abs, err := filepath.Abs(filename)
 	if err != nil {
-		f, err = os.Open(filename)
+		return nil, err
+	}
+	if including[abs] {
+		return nil, fmt.Errorf("%s includes itself", filename)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	var br *bufio.Reader
+	if filename == "-" {
+		b, err := readStdinGomfile()
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(bytes.NewReader(b))
+	} else {
+		f, err := os.Open(filename)
 		if err != nil {
 			return nil, err
 		}
+		defer f.Close()
+		br = bufio.NewReader(f)
 	}
-	br := bufio.NewReader(f)
 
 	goms := make([]Gom, 0)
 
 	n := 0
 	skip := 0
 	valid := true
+	var blocks [][]string
 	for {
 		n++
 		lb, _, err := br.ReadLine()
@@ -126,10 +582,22 @@ func parseGomfile(filename string) ([]Gom, error) {
 			}
 			return nil, err
 		}
-		line := strings.TrimSpace(string(lb))
-		if line == "" || strings.HasPrefix(line, "#") {
+		line := stripComment(string(lb))
+		if line == "" {
 			continue
 		}
+		// a line ending with a comma continues on the next one
+		start := n
+		for strings.HasSuffix(line, ",") {
+			n++
+			lb, _, err = br.ReadLine()
+			if err == io.EOF {
+				return nil, syntaxError(filename, start, line)
+			} else if err != nil {
+				return nil, err
+			}
+			line += " " + stripComment(string(lb))
+		}
 
 		name := ""
 		options := make(map[string]interface{})
@@ -139,7 +607,10 @@ func parseGomfile(filename string) ([]Gom, error) {
 			for i := range envs {
 				envs[i] = strings.TrimSpace(envs[i])[1:]
 			}
-			if matchEnv(envs) {
+			if allGroups {
+				blocks = append(blocks, envs)
+			}
+			if allGroups || matchEnv(envs) {
 				valid = true
 				continue
 			}
@@ -147,24 +618,54 @@ func parseGomfile(filename string) ([]Gom, error) {
 			skip++
 			continue
 		} else if re_end.MatchString(line) {
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
 			if !valid {
 				skip--
 				if skip < 0 {
-					return nil, fmt.Errorf("Syntax Error at line %d", n)
+					return nil, syntaxError(filename, start, line)
 				}
 			}
 			valid = false
 			continue
 		} else if skip > 0 {
 			continue
+		} else if re_include.MatchString(line) {
+			path := unquote(re_include.FindStringSubmatch(line)[1])
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			included, err := parseGomfileIncludes(path, including)
+			if err != nil {
+				return nil, err
+			}
+			goms = mergeGoms(goms, included...)
+			continue
 		} else if re_gom.MatchString(line) {
 			items = re_gom.FindStringSubmatch(line)[1:]
 			name = unquote(items[0])
 			parseOptions(items[1], options)
+		} else if re_gom_json.MatchString(line) {
+			items = re_gom_json.FindStringSubmatch(line)[1:]
+			name = unquote(items[0])
+			if parseJSONOptions(items[1], options) != nil {
+				return nil, syntaxError(filename, start, line)
+			}
 		} else {
-			return nil, fmt.Errorf("Syntax Error at line %d", n)
+			return nil, syntaxError(filename, start, line)
+		}
+		if !inVendor(name) {
+			return nil, fmt.Errorf("%s: the import path must stay inside the vendor directory", name)
+		}
+		if target, ok := options["target"]; ok {
+			if target, ok := target.(string); !ok || !inVendor(target) {
+				return nil, fmt.Errorf("%s: option :target must stay inside the vendor directory", name)
+			}
+		}
+		if _, ok := options["group"]; !ok && len(blocks) > 0 {
+			options["group"] = blocks[len(blocks)-1]
 		}
-		goms = append(goms, Gom{name, options})
+		goms = mergeGoms(goms, Gom{name: name, options: options})
 	}
-	return goms, nil
 }
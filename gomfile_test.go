@@ -2,7 +2,10 @@ package main
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -150,4 +153,482 @@ end
 	if !reflect.DeepEqual(goms, expected) {
 		t.Fatalf("Expected %v, but %v:", expected, goms)
 	}
+
+	customGroupList = []string{"custom_one", "custom_two"}
+	withoutGroupList = []string{"custom_one"}
+	defer func() { withoutGroupList = nil }()
+	goms, err = parseGomfile(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Gom{
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"foobar": "barbaz"}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileLock(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :tag => '3.14'
+gom 'github.com/mattn/go-gtk', :branch => 'master', :goos => 'linux'
+gom 'github.com/mattn/go-runewidth'
+gom 'github.com/mattn/go-colorable', :tag => 'v0.2.0'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	err = ioutil.WriteFile(filename+".lock", []byte(`
+gom 'github.com/mattn/go-sqlite3', :commit => 'asdfasdf'
+gom 'github.com/mattn/go-gtk', :commit => 'qwerqwer'
+gom 'github.com/mattn/go-runewidth'
+gom 'github.com/mattn/go-colorable', :commit => 'zxcvzxcv', :tag => 'v0.1.0'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename + ".lock")
+
+	goms, err := loadGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"commit": "asdfasdf"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"commit": "qwerqwer", "goos": "linux"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-colorable", options: map[string]interface{}{"tag": "v0.2.0"}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileGoarch(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :goarch => [:amd64, :arm64]
+gom 'github.com/mattn/go-gtk', :goarch => 'arm'
+gom 'github.com/mattn/go-runewidth'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allGoms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldGoarch := os.Getenv("GOARCH")
+	defer os.Setenv("GOARCH", oldGoarch)
+	os.Setenv("GOARCH", "arm")
+
+	goms := filterGoms(allGoms)
+	expected := []Gom{
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"goarch": "arm"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileNegation(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :goarch => [:!arm, :!386]
+gom 'github.com/mattn/go-gtk', :goarch => '!amd64, !arm'
+gom 'github.com/mattn/go-colorable', :goarch => 'arm, !arm'
+group :!production do
+    gom 'github.com/mattn/go-runewidth'
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldGoarch := os.Getenv("GOARCH")
+	defer os.Setenv("GOARCH", oldGoarch)
+	os.Setenv("GOARCH", "amd64")
+
+	allGoms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms := filterGoms(allGoms)
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"goarch": []string{"!arm", "!386"}}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+
+	*productionEnv = true
+	defer func() { *productionEnv = false }()
+	allGoms, err = parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allGoms) != 3 {
+		t.Fatalf("Expected %v, but %v:", 3, len(allGoms))
+	}
+}
+
+func TestGomfileComments(t *testing.T) {
+	filename, err := tempGomfile(`
+# pinned for the release
+gom 'github.com/mattn/go-sqlite3', :tag => '3.14' # the last one with cgo 1.0
+
+gom 'github.com/mattn/go-gtk', :commit => 'a#b',   # not a comment
+    :goos => [:linux, :darwin]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "3.14"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"commit": "a#b", "goos": []string{"linux", "darwin"}}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+
+	filename, err = tempGomfile("gom 'github.com/mattn/go-sqlite3'\ngom 'github.com/mattn/go-gtk' :tag => '3.14'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	_, err = parseGomfile(filename)
+	expectedErr := "Syntax Error at line 2 of " + filename + ": gom 'github.com/mattn/go-gtk' :tag => '3.14'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("Expected %v, but %v:", expectedErr, err)
+	}
+}
+
+func TestValidateGoms(t *testing.T) {
+	tests := []struct {
+		gomfile  string
+		expected string
+	}{
+		{`gom 'github.com/mattn/go-sqlite3', :tag => '3.14', :goos => [:linux]`, ""},
+		{`gom 'github.com/mattn/go-sqlite3', :tag => '3.14', :commit => 'asdfasdf'`, "github.com/mattn/go-sqlite3: options :commit and :tag can't be used together"},
+		{`gom 'github.com/mattn/go-gtk', :private => 'true', :command => 'git clone x'`, "github.com/mattn/go-gtk: options :command and :private can't be used together"},
+		{`gom 'github.com/mattn/go-gtk', :comit => 'asdfasdf'`, "github.com/mattn/go-gtk: unknown option :comit"},
+		{`gom 'github.com/mattn/go-gtk', :commit => 'asdfasdf', :depth => '50', :recursive => 'true'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :depth => 'all'`, "github.com/mattn/go-gtk: option :depth must be a positive number"},
+		{`gom 'github.com/mattn/go-gtk', :commit => 'asdfasdf', :since => '2020-01-01'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :depth => '50', :since => '2020-01-01'`, "github.com/mattn/go-gtk: options :depth and :since can't be used together"},
+		{`gom 'bitbucket.org/user/repo', :branch => 'stable', :bookmark => 'release'`, "bitbucket.org/user/repo: options :branch and :bookmark can't be used together"},
+		{`gom 'github.com/mattn/go-gtk', :branch => 'develop', :track => 'true'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :tag => 'v1.0', :track => 'true'`, "github.com/mattn/go-gtk: option :track needs a :branch"},
+		{`gom 'github.com/mattn/go-gtk', :sha256 => 'e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :sha256 => 'e3b0c442'`, "github.com/mattn/go-gtk: option :sha256 must be 64 lowercase hex digits"},
+		{`gom 'github.com/mattn/go-gtk', :strip_tests => 'true', :sha256 => 'e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855'`, "github.com/mattn/go-gtk: options :sha256 and :strip_tests can't be used together"},
+		{`gom 'github.com/mattn/go-gtk', :retries => '0'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :branch => 'develop', :date => '2020-01-02'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :tag => 'v1.0', :date => '2020-01-02'`, "github.com/mattn/go-gtk: options :date and :tag can't be used together"},
+		{`gom 'github.com/mattn/go-gtk', :retries => 'many'`, "github.com/mattn/go-gtk: option :retries must be a number"},
+		{`gom 'github.com/mattn/go-gtk', :go => 'go1.19'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :go => '/usr/local/go1.19/bin/go'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :go => '1.19'`, "github.com/mattn/go-gtk: option :go must be a Go release like go1.19 or the absolute path of a go command"},
+		{`gom 'git.example.com/team/group/repo/pkg', :private => 'true', :repo_root => 'git.example.com/team/group/repo'`, ""},
+		{`gom 'git.example.com/team/group/repo', :private => 'true', :repo_root => 'git.example.com/team/gr'`, "git.example.com/team/group/repo: option :repo_root must be the import path or one of its parents"},
+		{`gom 'github.com/mattn/...', :glob => 'true', :branch => 'master'`, ""},
+		{`gom 'github.com/...', :glob => 'true'`, "github.com/...: option :glob needs an import path like github.com/org/..."},
+		{`gom 'example.com/lib', :command => 'fetch-lib', :vcs => 'git'`, ""},
+		{`gom 'example.com/lib', :vcs => 'cvs'`, "example.com/lib: option :vcs must be one of bzr, darcs, fossil, git, hg or svn"},
+		{`gom 'github.com/mattn/...', :glob => 'true', :commit => 'asdfasdf'`, "github.com/mattn/...: options :glob and :commit can't be used together"},
+	}
+	for _, test := range tests {
+		filename, err := tempGomfile(test.gomfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goms, err := parseGomfile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = validateGoms(goms)
+		if test.expected == "" {
+			if err != nil {
+				t.Fatalf("Expected no error, but %v:", err)
+			}
+		} else if err == nil || err.Error() != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, err)
+		}
+	}
+}
+
+func TestGomfileInclude(t *testing.T) {
+	base, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :tag => '3.14'
+gom 'github.com/mattn/go-gtk'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(base)
+	filename, err := tempGomfile(`
+include '` + filepath.Base(base) + `'
+gom 'github.com/mattn/go-sqlite3', :tag => '3.15'
+gom 'github.com/mattn/go-runewidth'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "3.15"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+
+	err = ioutil.WriteFile(base, []byte("include '"+filepath.Base(filename)+"'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parseGomfile(filename)
+	if err == nil {
+		t.Fatal("Expected an error for an include cycle")
+	}
+}
+
+func TestGomfileJSON(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :tag => '3.14'
+gom "github.com/mattn/go-gtk" {"tag": "v1", "group": ["test"],
+    "depth": 1, "shallow": true} # generated
+gom 'github.com/mattn/go-runewidth' {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "3.14"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1", "group": []string{"test"}, "depth": "1", "shallow": "true"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+
+	for _, bad := range []string{
+		`gom 'github.com/mattn/go-gtk' {"tag": v1}`,
+		`gom 'github.com/mattn/go-gtk' {"env": {"CGO_ENABLED": "0"}}`,
+		`gom 'github.com/mattn/go-gtk' {"group": [1]}`,
+		`gom 'github.com/mattn/go-gtk' {} {}`,
+	} {
+		filename, err := tempGomfile(bad + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(filename)
+		_, err = parseGomfile(filename)
+		expectedErr := "Syntax Error at line 1 of " + filename + ": " + bad
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("Expected %v, but %v:", expectedErr, err)
+		}
+	}
+}
+
+func TestGomfileTarget(t *testing.T) {
+	tests := []struct {
+		gomfile  string
+		expected string
+	}{
+		{`gom 'github.com/mattn/go-gtk', :target => 'gtk/./v2/'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :target => 'gtk/../gtk2'`, ""},
+		{`gom 'github.com/mattn/go-gtk', :target => '../../etc'`, "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+		{`gom 'github.com/mattn/go-gtk', :target => 'gtk/../..'`, "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+		{`gom 'github.com/mattn/go-gtk', :target => 'gtk/..'`, "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+		{`gom 'github.com/mattn/go-gtk', :target => '/tmp/gtk'`, "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+		{`gom 'github.com/mattn/go-gtk', :target => [:gtk]`, "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+		{`gom '../../../home/user/.ssh'`, "../../../home/user/.ssh: the import path must stay inside the vendor directory"},
+		{`gom 'github.com/../..'`, "github.com/../..: the import path must stay inside the vendor directory"},
+	}
+	for _, test := range tests {
+		filename, err := tempGomfile(test.gomfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(filename)
+		_, err = parseGomfile(filename)
+		if test.expected == "" && err != nil {
+			t.Fatalf("Expected no error, but %v:", err)
+		}
+		if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, err)
+		}
+	}
+
+	gom := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"target": "gtk/./v2/"}}
+	if target := gom.Target(); target != "gtk/v2" {
+		t.Fatalf("Expected %v, but %v:", "gtk/v2", target)
+	}
+	gom = Gom{name: "github.com/mattn/go-gtk/", options: map[string]interface{}{}}
+	if target := gom.Target(); target != "github.com/mattn/go-gtk" {
+		t.Fatalf("Expected %v, but %v:", "github.com/mattn/go-gtk", target)
+	}
+}
+
+func TestGomfileStdin(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :tag => '3.14'
+gom 'github.com/mattn/go-runewidth'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin, stdinGomfile, stdinRead = stdin, nil, false }()
+
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "3.14"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	// stdin is read once, but the Gomfile can be parsed again
+	for i := 0; i < 2; i++ {
+		goms, err := loadGomfile("-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(goms, expected) {
+			t.Fatalf("Expected %v, but %v:", expected, goms)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		index, total int
+		expected     string
+	}{
+		{0, 0, ""},
+		{1, 3, "[1/3] "},
+		{12, 12, "[12/12] "},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk", index: test.index, total: test.total}
+		if got := gom.progress(); got != test.expected {
+			t.Fatalf("Expected %q, but %q:", test.expected, got)
+		}
+	}
+}
+
+func TestOnlyGoms(t *testing.T) {
+	allGoms := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"group": "test"}},
+	}
+	goms := allGoms[:2]
+
+	only, err := onlyGoms(allGoms, goms, []string{"github.com/mattn/go-gtk", "github.com/mattn/go-gtk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{allGoms[1]}
+	if !reflect.DeepEqual(only, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, only)
+	}
+
+	for _, name := range []string{"github.com/mattn/go-runewidth", "github.com/mattn/go-pointer"} {
+		if _, err := onlyGoms(allGoms, goms, []string{name}); err == nil {
+			t.Fatalf("Expected an error for %v, but none", name)
+		}
+	}
+}
+
+func TestCheckGomfile(t *testing.T) {
+	tests := []struct {
+		gomfile  string
+		expected string
+	}{
+		{"gom 'github.com/mattn/go-gtk', :tag => 'v1.0'\ngroup :test do\n  gom 'github.com/mattn/go-sqlite3'\nend\n", ""},
+		{"group :test do\n  gom 'github.com/mattn/go-sqlite3', :tag => 'v1', :commit => 'asdfasdf'\nend\n", "github.com/mattn/go-sqlite3: options :commit and :tag can't be used together"},
+		{"gom 'github.com/mattn/go-gtk', :target => '../gtk'\n", "github.com/mattn/go-gtk: option :target must stay inside the vendor directory"},
+	}
+	for _, test := range tests {
+		filename, err := tempGomfile(test.gomfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = checkGomfile(filename)
+		if test.expected == "" {
+			if err != nil {
+				t.Fatalf("Expected no error, but %v:", err)
+			}
+		} else if err == nil || !strings.HasSuffix(err.Error(), test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, err)
+		}
+	}
+}
+
+func TestCheckGomfileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(filename, []byte("gom 'github.com/mattn/go-gtk', :tag => 'v1.0.0', :module => 'true'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendor := filepath.Join(dir, "_vendor")
+	gtk := filepath.Join(vendor, "src", "github.com", "mattn", "go-gtk")
+	err = os.MkdirAll(gtk, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(gtk, moduleStamp), []byte("v1.0.0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldVendor, oldGomfile := vendorFolder, *gomFileName
+	vendorFolder, *gomFileName = vendor, filename
+	defer func() { vendorFolder, *gomFileName = oldVendor, oldGomfile }()
+
+	// the lock pins the tag to a commit and keeps the tag
+	err = genGomfileLock(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), ":commit => 'v1.0.0', :tag => 'v1.0.0'") {
+		t.Fatalf("Expected a commit and a tag, but %s:", b)
+	}
+	err = check()
+	if err != nil {
+		t.Fatalf("Expected no error, but %v:", err)
+	}
 }
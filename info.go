@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// info prints how gom resolves the options of the gom importPath: where it
+// is vendored, what it is pinned to, whether the groups and the platform
+// select it, and how it is fetched. Nothing is changed.
+func info(args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	declared, err := parseGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	var gom, unlocked *Gom
+	for i := range allGoms {
+		if allGoms[i].name == args[0] {
+			gom, unlocked = &allGoms[i], &declared[i]
+		}
+	}
+	if gom == nil {
+		return fmt.Errorf("%s is not in %s", args[0], *gomFileName)
+	}
+	return gom.writeInfo(os.Stdout, vendor, unlocked, filterGoms(allGoms))
+}
+
+// writeInfo writes the resolved options of gom to w. unlocked is gom as
+// the Gomfile declares it, before Gomfile.lock pins it, and selected are
+// the goms the groups and the platform select.
+func (gom *Gom) writeInfo(w io.Writer, vendor string, unlocked *Gom, selected []Gom) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	listed := func(key string) string {
+		if values := optionValues(gom.options[key]); len(values) > 0 {
+			return strings.Join(values, ", ")
+		}
+		return "-"
+	}
+	isTrue := func(key string) bool {
+		value, _ := gom.options[key].(string)
+		return value == "true"
+	}
+
+	fmt.Fprintf(tw, "name:\t%s\n", gom.name)
+	fmt.Fprintf(tw, "target:\t%s\n", gom.Target())
+	fmt.Fprintf(tw, "vendor path:\t%s\n", filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target())))
+	fmt.Fprintf(tw, "pin:\t%s\n", gom.describePin(unlocked))
+	fmt.Fprintf(tw, "group:\t%s\n", listed("group"))
+	fmt.Fprintf(tw, "goos:\t%s\n", listed("goos"))
+	fmt.Fprintf(tw, "goarch:\t%s\n", listed("goarch"))
+	found := false
+	for _, g := range selected {
+		found = found || g.name == gom.name
+	}
+	fmt.Fprintf(tw, "selected:\t%s\n", yesNo(found))
+	fmt.Fprintf(tw, "module:\t%s\n", yesNo(gom.module()))
+	fmt.Fprintf(tw, "private:\t%s\n", yesNo(isTrue("private")))
+	fmt.Fprintf(tw, "insecure:\t%s\n", yesNo(gom.insecure()))
+	fmt.Fprintf(tw, "skipdep:\t%s\n", yesNo(isTrue("skipdep")))
+	fetch, err := gom.fetchCommands(vendor)
+	if err != nil {
+		return err
+	}
+	for i, cmd := range fetch {
+		label := ""
+		if i == 0 {
+			label = "fetch:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, redact(cmd))
+	}
+
+	keys := make([]string, 0, len(gom.options))
+	for key := range gom.options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		label := ""
+		if i == 0 {
+			label = "options:"
+		}
+		value := gom.options[key]
+		if values, ok := value.([]string); ok {
+			value = "[" + strings.Join(values, ", ") + "]"
+		}
+		fmt.Fprintf(tw, "%s\t:%s => %s\n", label, key, redact(fmt.Sprint(value)))
+	}
+	return tw.Flush()
+}
+
+// describePin says what gom is checked out at, and where Gomfile.lock
+// pinned it in place of the pin of unlocked.
+func (gom *Gom) describePin(unlocked *Gom) string {
+	if date, ok := gom.options["date"].(string); ok {
+		return "the last commit before " + date
+	}
+	kind, ref := gom.pin()
+	if kind == "" {
+		return "none, the latest revision go get fetches"
+	}
+	pin := kind + " " + ref
+	switch {
+	case gom.tracks():
+		pin += ", following its tip"
+	case kind == "tag" && isTagPattern(ref):
+		pin += ", the newest matching tag"
+	}
+	if uKind, uRef := unlocked.pin(); uKind != kind || uRef != ref {
+		if uKind == "" {
+			pin += " from Gomfile.lock"
+		} else {
+			pin += " from Gomfile.lock, for " + uKind + " " + uRef
+		}
+	}
+	return pin
+}
+
+// fetchCommands returns the commands install runs to fetch gom, as clone
+// picks them, in the order they run.
+func (gom *Gom) fetchCommands(vendor string) ([]string, error) {
+	var cmds []string
+	srcdir := filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target()))
+	commit, pinned := gom.options["commit"].(string)
+	if gom.module() {
+		download := "go mod download " + gom.name + "@" + gom.moduleVersion()
+		if has(gom.options, "module") {
+			return []string{download}, nil
+		}
+		// -proxy falls back to the repository
+		cmds = append(cmds, download+" from "+*proxy+", or else:")
+	}
+	if command, ok := gom.options["command"].(string); ok {
+		customCmd, err := gom.customCommand(command, srcdir)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, strings.Join(customCmd, " "))
+	} else if private, _ := gom.options["private"].(string); private == "true" {
+		url := gom.privateURL()
+		if tokenURL := gom.tokenURL(); tokenURL != "" {
+			url = tokenURL
+		}
+		clone := gom.privateCloneCommand(url, srcdir)
+		cmds = append(cmds, strings.Join(clone, " ")+", or "+clone[0]+" pull if it is there")
+	} else if gom.shallow() {
+		if !has(gom.options, "target") {
+			srcdir = filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.repoRoot()))
+		}
+		cmds = append(cmds, "git clone "+strings.Join(gom.shallowArgs(), " ")+" https://"+gom.repoRoot()+" "+srcdir)
+	} else if pinned && !has(gom.options, "target") && !gom.insecure() {
+		if url, ok := gom.gitURL(); ok {
+			cmds = append(cmds, "git fetch --depth 1 "+url+" "+commit)
+		}
+	}
+	if skipdep, _ := gom.options["skipdep"].(string); skipdep == "true" {
+		return cmds, nil
+	}
+	goGet := "go get -d"
+	if gom.insecure() {
+		goGet += " -insecure"
+	}
+	cmds = append(cmds, goGet+" "+gom.name)
+	return cmds, nil
+}
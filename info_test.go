@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescribePin(t *testing.T) {
+	tests := []struct {
+		options  map[string]interface{}
+		unlocked map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{}, map[string]interface{}{}, "none, the latest revision go get fetches"},
+		{map[string]interface{}{"tag": "v1.*"}, map[string]interface{}{"tag": "v1.*"}, "tag v1.*, the newest matching tag"},
+		{map[string]interface{}{"branch": "main", "track": "true"}, map[string]interface{}{"branch": "main", "track": "true"}, "branch main, following its tip"},
+		{map[string]interface{}{"commit": "abc123"}, map[string]interface{}{"tag": "v1.0"}, "commit abc123 from Gomfile.lock, for tag v1.0"},
+		{map[string]interface{}{"commit": "abc123"}, map[string]interface{}{}, "commit abc123 from Gomfile.lock"},
+		{map[string]interface{}{"date": "2020-01-02"}, map[string]interface{}{"date": "2020-01-02"}, "the last commit before 2020-01-02"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk", options: test.options}
+		unlocked := Gom{name: "github.com/mattn/go-gtk", options: test.unlocked}
+		if pin := gom.describePin(&unlocked); pin != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, pin)
+		}
+	}
+}
+
+func TestFetchCommands(t *testing.T) {
+	tests := []struct {
+		options  map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{}, []string{"go get -d github.com/mattn/go-gtk"}},
+		{map[string]interface{}{"commit": "abc123"}, []string{"git fetch --depth 1 https://github.com/mattn/go-gtk abc123", "go get -d github.com/mattn/go-gtk"}},
+		{map[string]interface{}{"command": "cp -r /src", "skipdep": "true"}, []string{"cp -r /src /vendor/src/github.com/mattn/go-gtk"}},
+		{map[string]interface{}{"shallow": "true", "insecure": "true"}, []string{"git clone --depth 1 https://github.com/mattn/go-gtk /vendor/src/github.com/mattn/go-gtk", "go get -d -insecure github.com/mattn/go-gtk"}},
+		{map[string]interface{}{"module": "true", "tag": "v1.2.3"}, []string{"go mod download github.com/mattn/go-gtk@v1.2.3"}},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk", options: test.options}
+		cmds, err := gom.fetchCommands("/vendor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cmds, test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, cmds)
+		}
+	}
+}
@@ -1,76 +1,259 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
 )
 
 type vcsCmd struct {
-	checkout     []string
-	update       []string
-	revision     []string
-	revisionMask string
+	checkout       []string
+	update         []string
+	revision       []string
+	revisionMask   string
+	resolve        []string          // prints the revision a ref points to
+	status         []string          // prints the uncommitted changes to tracked files
+	remoteURL      []string          // prints the URL the repository is fetched from
+	fetchRev       []string          // fetches a single revision without its history
+	pullBookmark   []string          // fetches the latest revisions along with a bookmark
+	remoteBranches bool              // whether branches are fetched as remote/branch
+	refFormats     map[string]string // formats that name a tag, branch or bookmark unambiguously
 }
 
 var (
 	hg = &vcsCmd{
-		[]string{"hg", "update"},
-		[]string{"hg", "pull"},
-		[]string{"hg", "id", "-i"},
-		"^(.+)$",
+		checkout:     []string{"hg", "update"},
+		update:       []string{"hg", "pull"},
+		pullBookmark: []string{"hg", "pull", "-B"},
+		revision:     []string{"hg", "id", "-i"},
+		revisionMask: "^(.+)$",
+		resolve:      []string{"hg", "id", "-i", "-r"},
+		status:       []string{"hg", "status", "-mard"},
+		remoteURL:    []string{"hg", "paths", "default"},
+		// "hg update NAME" takes whichever of a bookmark, branch, tag or
+		// revision has that name, so use revsets to pick the right one
+		refFormats: map[string]string{
+			"bookmark": "bookmark(%q)",
+			"branch":   "branch(%q)",
+			"tag":      "tag(%q)",
+		},
 	}
 	git = &vcsCmd{
-		[]string{"git", "checkout", "-q"},
-		[]string{"git", "fetch"},
-		[]string{"git", "rev-parse", "HEAD"},
-		"^(.+)$",
+		checkout:       []string{"git", "checkout", "-q"},
+		update:         []string{"git", "fetch"},
+		revision:       []string{"git", "rev-parse", "HEAD"},
+		revisionMask:   "^(.+)$",
+		resolve:        []string{"git", "rev-list", "-n", "1"},
+		status:         []string{"git", "status", "--porcelain", "--untracked-files=no"},
+		remoteURL:      []string{"git", "ls-remote", "--get-url"},
+		fetchRev:       []string{"git", "fetch", "-q", "--depth", "1", "origin"},
+		remoteBranches: true,
 	}
+	// bzr pins by revision id, since revision numbers differ between
+	// branches; commits that are revision numbers are still understood
 	bzr = &vcsCmd{
-		[]string{"bzr", "revert", "-r"},
-		[]string{"bzr", "pull"},
-		[]string{"bzr", "log", "-r-1", "--line"},
-		"^([0-9]+)",
+		checkout:     []string{"bzr", "revert", "-r"},
+		update:       []string{"bzr", "pull"},
+		revision:     []string{"bzr", "revision-info"},
+		revisionMask: `^\S+ (\S+)$`,
+		resolve:      []string{"bzr", "revision-info", "-r"},
+		status:       []string{"bzr", "status", "--short", "-V"},
+		remoteURL:    []string{"bzr", "config", "parent_location"},
+		refFormats: map[string]string{
+			"commit": "revid:%s",
+		},
+	}
+	svn = &vcsCmd{
+		checkout:     []string{"svn", "switch", "-q"},
+		update:       []string{"svn", "update", "-q"},
+		revision:     []string{"svn", "info"},
+		revisionMask: "(?m)^Revision: ([0-9]+)$",
+		status:       []string{"svn", "status", "-q"},
+		remoteURL:    []string{"svn", "info", "--show-item", "url"},
+	}
+	fossil = &vcsCmd{
+		checkout:     []string{"fossil", "update"},
+		update:       []string{"fossil", "pull"},
+		revision:     []string{"fossil", "info"},
+		revisionMask: "(?m)^checkout:\\s+([0-9a-f]+)",
+		status:       []string{"fossil", "changes"},
+		remoteURL:    []string{"fossil", "remote"},
+	}
+	// darcs can't move a repository to an older patch, so there is no
+	// checkout; a pinned darcs repository has to be cloned at its pin
+	darcs = &vcsCmd{
+		update:       []string{"darcs", "pull", "-a"},
+		revision:     []string{"darcs", "log", "--last", "1"},
+		revisionMask: "(?m)^patch ([0-9a-f]+)",
 	}
 )
 
 func (vcs *vcsCmd) Checkout(p, destination string) error {
+	if vcs.checkout == nil {
+		return errors.New("checking out a revision is not supported for this VCS")
+	}
 	args := append(vcs.checkout, destination)
 	return vcsExec(p, args...)
 }
 
+// Dirty reports whether the checkout at p has uncommitted changes to the
+// files under version control.
+func (vcs *vcsCmd) Dirty(p string) (bool, error) {
+	if vcs.status == nil {
+		return false, errors.New("checking for changes is not supported for this VCS")
+	}
+	out, err := vcsOutput(p, vcs.status...)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// Name returns the command of the VCS, such as git.
+func (vcs *vcsCmd) Name() string {
+	return vcs.revision[0]
+}
+
+// RemoteURL returns the URL the repository at p is fetched from, or "" if
+// it can't tell.
+func (vcs *vcsCmd) RemoteURL(p string) string {
+	if vcs.remoteURL == nil {
+		return ""
+	}
+	out, err := vcsOutput(p, vcs.remoteURL...)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
 func (vcs *vcsCmd) Update(p string) error {
 	return vcsExec(p, vcs.update...)
 }
 
+// UpdateRef is Update, except that it makes sure to fetch ref, a commit,
+// tag, branch or bookmark as given by kind. hg pull leaves out bookmarks
+// the repository doesn't know yet, so they are pulled by name.
+func (vcs *vcsCmd) UpdateRef(p, kind, ref string) error {
+	if kind == "bookmark" && vcs.pullBookmark != nil {
+		return vcsExec(p, append(append([]string{}, vcs.pullBookmark...), ref)...)
+	}
+	return vcs.Update(p)
+}
+
 func (vcs *vcsCmd) Revision(dir string) (string, error) {
-	args := append(vcs.revision)
+	args := vcs.revision
 	if *verbose {
 		fmt.Printf("cd %q && %q\n", dir, args)
 	}
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd, done := command(args)
 	cmd.Dir = dir
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = stderr
 	b, err := cmd.Output()
-	if err != nil {
+	if err = done(err); err != nil {
 		println(err.Error())
 		return "", err
 	}
-	rev := strings.TrimSpace(string(b))
+	return vcs.mask(string(b)), nil
+}
+
+// mask picks the revision out of what the revision or resolve command of
+// the VCS printed.
+func (vcs *vcsCmd) mask(out string) string {
+	rev := strings.TrimSpace(out)
 	if vcs.revisionMask != "" {
-		return regexp.MustCompile(vcs.revisionMask).FindString(rev), nil
+		// Use the first submatch when the mask has one, so that masks can
+		// pick the revision out of labelled output such as "svn info".
+		m := regexp.MustCompile(vcs.revisionMask).FindStringSubmatch(rev)
+		switch len(m) {
+		case 0:
+			return ""
+		case 1:
+			return m[0]
+		}
+		return m[1]
+	}
+	return rev
+}
+
+// Resolve returns the revision that ref points to in the repository at dir.
+func (vcs *vcsCmd) Resolve(dir, ref string) (string, error) {
+	if vcs.resolve == nil {
+		return "", errors.New("resolving refs is not supported for this VCS")
+	}
+	args := append(append([]string{}, vcs.resolve...), ref)
+	if *verbose {
+		fmt.Printf("cd %q && %q\n", dir, args)
+	}
+	cmd, done := command(args)
+	cmd.Dir = dir
+	b, err := cmd.Output()
+	if err = done(err); err != nil {
+		return "", fmt.Errorf("can't resolve %s: %v", ref, err)
 	}
-	return rev, nil
+	return vcs.mask(string(b)), nil
 }
 
-func (vcs *vcsCmd) Sync(p, destination string) error {
+// FetchRevision fetches rev alone into the repository at p, with env added
+// to the environment of the command.
+func (vcs *vcsCmd) FetchRevision(p string, env []string, rev string) error {
+	if vcs.fetchRev == nil {
+		return errors.New("fetching a single revision is not supported for this VCS")
+	}
+	args := append(append([]string{}, vcs.fetchRev...), rev)
+	return vcsExecEnv(p, env, args...)
+}
+
+// Track fetches the latest revisions into the repository at p and checks
+// out the tip of branch. When the VCS keeps the branches of each remote
+// apart, as git does, they are fetched from remote.
+func (vcs *vcsCmd) Track(p, remote, branch string) error {
+	if !vcs.remoteBranches {
+		err := vcs.Update(p)
+		if err != nil {
+			return err
+		}
+		return vcs.Checkout(p, vcs.Ref("branch", branch))
+	}
+	err := vcsExec(p, append(append([]string{}, vcs.update...), remote)...)
+	if err != nil {
+		return err
+	}
+	return vcs.Checkout(p, remote+"/"+branch)
+}
+
+// Ref returns how the VCS names ref, which is a commit, tag, branch or
+// bookmark as given by kind.
+func (vcs *vcsCmd) Ref(kind, ref string) string {
+	if vcs == bzr && kind == "commit" && isRevno(ref) {
+		return ref
+	}
+	if format, ok := vcs.refFormats[kind]; ok {
+		return fmt.Sprintf(format, ref)
+	}
+	return ref
+}
+
+// Sync checks out ref, a commit, tag, branch or bookmark as given by kind,
+// fetching the latest revisions first if the repository at p doesn't have
+// it yet.
+func (vcs *vcsCmd) Sync(p, kind, ref string) error {
+	destination := vcs.Ref(kind, ref)
 	err := vcs.Checkout(p, destination)
 	if err != nil {
-		err = vcs.Update(p)
+		err = vcs.UpdateRef(p, kind, ref)
 		if err != nil {
 			return err
 		}
@@ -79,15 +262,86 @@ func (vcs *vcsCmd) Sync(p, destination string) error {
 	return err
 }
 
+var re_revno = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// isRevno reports whether rev is a bzr revision number, such as 42 or the
+// 1.2.3 of a merged revision, rather than a revision id.
+func isRevno(rev string) bool {
+	return re_revno.MatchString(rev)
+}
+
+// vcsForDir returns the vcsCmd whose metadata lives in p, or nil. Like
+// isDir and isFile it follows symlinks, so symlinked metadata counts too.
+func vcsForDir(p string) *vcsCmd {
+	switch {
+	case isDir(filepath.Join(p, ".git")), isFile(filepath.Join(p, ".git")):
+		// in submodules and worktrees .git is a file pointing elsewhere
+		return git
+	case isDir(filepath.Join(p, ".hg")):
+		return hg
+	case isDir(filepath.Join(p, ".bzr")):
+		return bzr
+	case isDir(filepath.Join(p, ".svn")):
+		return svn
+	case isFile(filepath.Join(p, ".fslckout")), isFile(filepath.Join(p, "_FOSSIL_")):
+		// fossil keeps its checkout database in a single file
+		return fossil
+	case isDir(filepath.Join(p, "_darcs")):
+		return darcs
+	}
+	return nil
+}
+
 func vcsExec(dir string, args ...string) error {
-	if *verbose {
+	return vcsExecEnv(dir, nil, args...)
+}
+
+// vcsExecEnv is vcsExec with env added to the environment of the command.
+func vcsExecEnv(dir string, env []string, args ...string) error {
+	return vcsExecOut(dir, env, stdout, stderr, args...)
+}
+
+// vcsExecOut is vcsExecEnv writing what the command prints to out and errOut.
+func vcsExecOut(dir string, env []string, out, errOut io.Writer, args ...string) error {
+	if *verbose || *dryRun {
+		fmt.Println(redact(fmt.Sprintf("cd %q && %s%q", dir, strings.Join(append(env, ""), " "), args)))
+	}
+	if *dryRun {
+		return nil
+	}
+	cmd, done := command(args)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	return done(cmd.Run())
+}
+
+// vcsTest runs a command silently in dir and reports whether it succeeded.
+func vcsTest(dir string, args ...string) bool {
+	if *verbose || *dryRun {
 		fmt.Printf("cd %q && %q\n", dir, args)
 	}
-	cmd := exec.Command(args[0], args[1:]...)
+	if *dryRun {
+		return true
+	}
+	cmd, done := command(args)
+	cmd.Dir = dir
+	return done(cmd.Run()) == nil
+}
+
+// vcsOutput runs a command in dir and returns what it prints.
+func vcsOutput(dir string, args ...string) (string, error) {
+	if *verbose {
+		fmt.Println(redact(fmt.Sprintf("cd %q && %q", dir, args)))
+	}
+	cmd, done := command(args)
 	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	cmd.Stderr = stderr
+	b, err := cmd.Output()
+	return string(b), done(err)
 }
 
 func has(c interface{}, key string) bool {
@@ -105,40 +359,223 @@ func has(c interface{}, key string) bool {
 	return false
 }
 
+// gomError is the failure of a single gom during install.
+type gomError struct {
+	name string
+	err  error
+}
+
+// gomErrors collects the failures of an install run with -keep-going.
+type gomErrors []gomError
+
+func (errs gomErrors) Error() string {
+	msg := fmt.Sprintf("%d packages failed:", len(errs))
+	for _, e := range errs {
+		msg += fmt.Sprintf("\n  %s: %v", e.name, e.err)
+	}
+	return msg
+}
+
+// has reports whether the gom called name is among errs.
+func (errs gomErrors) has(name string) bool {
+	for _, e := range errs {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// re_unfetched matches what go get prints about a package it can't fetch.
+var re_unfetched = regexp.MustCompile(`(cannot find package|unrecognized import path) "([^"]+)"`)
+
+// unfetchedError names the packages go get couldn't fetch, with why.
+type unfetchedError []unfetched
+
+type unfetched struct {
+	importPath string
+	reason     string
+}
+
+func (errs unfetchedError) Error() string {
+	msg := "go get couldn't fetch"
+	for i, e := range errs {
+		if i > 0 {
+			msg += ","
+		}
+		msg += fmt.Sprintf(" %s (%s)", e.importPath, e.reason)
+	}
+	return msg
+}
+
+// findUnfetched returns the packages the output of go get says it couldn't
+// fetch, or nil.
+func findUnfetched(output string) error {
+	var errs unfetchedError
+	seen := make(map[string]bool)
+	for _, m := range re_unfetched.FindAllStringSubmatch(output, -1) {
+		if seen[m[2]] {
+			continue
+		}
+		seen[m[2]] = true
+		errs = append(errs, unfetched{m[2], m[1]})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// goGetMu keeps goms fetched at once from running go get at once, since
+// go get fetches their dependencies too, which they may share.
+var goGetMu sync.Mutex
+
+// goGet runs go get for gom. It fails naming the packages go get couldn't
+// fetch even when go get exits zero, which it may do when only some of
+// the packages are missing, so that the build doesn't fail later with
+// an import error that seems unrelated.
+func (gom *Gom) goGet(args []string) error {
+	goGetMu.Lock()
+	defer goGetMu.Unlock()
+	var buf bytes.Buffer
+	err := runVCSOut(args, gom.fetchEnv(), stdout, io.MultiWriter(stderr, &buf))
+	if unfetched := findUnfetched(buf.String()); unfetched != nil {
+		return unfetched
+	}
+	return err
+}
+
+// Clone fetches gom into the vendor directory. When that fails and gom
+// has a mirror, it is cloned from the mirror instead.
 func (gom *Gom) Clone(args []string) error {
+	err := gom.cloneRetrying(args)
+	mirror, ok := gom.options["mirror"].(string)
+	if err == nil || !ok {
+		return err
+	}
+	fmt.Printf("Warning: fetching %s failed: %v; retrying from %s\n", gom.name, err, mirror)
+	return gom.cloneMirror(mirror, args)
+}
+
+// cloneRetrying is clone, tried again up to retries times while it fails,
+// waiting longer before every attempt.
+func (gom *Gom) cloneRetrying(args []string) error {
+	n := gom.retries()
+	err := gom.clone(args)
+	for i := 1; err != nil && i <= n && !*dryRun; i++ {
+		wait := time.Duration(1<<uint(i-1)) * time.Second
+		if wait > 30*time.Second {
+			wait = 30 * time.Second
+		}
+		fmt.Printf("Warning: fetching %s failed: %v; retrying in %v (%d of %d)\n", gom.name, err, wait, i, n)
+		select {
+		case <-time.After(wait):
+		case <-rootCtx.Done():
+			return err
+		}
+		err = gom.clone(args)
+	}
+	return err
+}
+
+// retries returns how often a failed fetch of gom is retried: its retries
+// option, or else -retries.
+func (gom *Gom) retries() int {
+	if n, ok := gom.options["retries"].(string); ok {
+		if i, err := strconv.Atoi(n); err == nil {
+			return i
+		}
+	}
+	return *retries
+}
+
+// cloneMirror clones gom's repository from the git repository at mirror
+// into the place of its import path, and then lets go get fetch the
+// dependencies. A checkout that is already there is kept.
+func (gom *Gom) cloneMirror(mirror string, args []string) error {
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
 	}
-	if command, ok := gom.options["command"].(string); ok {
-		target, ok := gom.options["target"].(string)
-		if !ok {
-			target = gom.name
+	srcdir := gom.cacheSrcDir(vendor)
+	if vcsForDir(srcdir) == nil {
+		// remove what the failed fetch left
+		os.RemoveAll(srcdir)
+		var cloneArgs []string
+		if gom.shallow() {
+			cloneArgs = gom.shallowArgs()
+		}
+		fmt.Printf("%sfetching %s from mirror %s\n", gom.progress(), gom.name, mirror)
+		err = gom.gitClone(mirror, srcdir, cloneArgs...)
+		if err != nil {
+			return err
 		}
+	}
+	if skipdep, ok := gom.options["skipdep"].(string); ok && skipdep == "true" {
+		return nil
+	}
+	cmdArgs := []string{"go", "get", "-d"}
+	if gom.insecure() {
+		cmdArgs = append(cmdArgs, "-insecure")
+	}
+	cmdArgs = append(cmdArgs, args...)
+	return gom.goGet(append(cmdArgs, gom.name))
+}
 
-		srcdir := filepath.Join(vendor, "src", target)
-		if err := os.MkdirAll(srcdir, 0755); err != nil {
+// insecure reports whether go get may fetch gom over insecure schemes
+// such as http. The insecure option of gom wins over -insecure.
+func (gom *Gom) insecure() bool {
+	if insecure, ok := gom.options["insecure"].(string); ok {
+		return insecure == "true"
+	}
+	return *insecureFlag
+}
+
+func (gom *Gom) clone(args []string) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	if gom.module() {
+		if downloaded, err := gom.fetchModule(vendor); downloaded {
 			return err
 		}
+	}
+	if command, ok := gom.options["command"].(string); ok {
+		srcdir := filepath.Join(vendor, "src", gom.Target())
+		if !*dryRun {
+			if err := os.MkdirAll(srcdir, 0755); err != nil {
+				return err
+			}
+		}
 
-		customCmd := strings.Split(command, " ")
-		customCmd = append(customCmd, srcdir)
+		customCmd, err := gom.customCommand(command, srcdir)
+		if err != nil {
+			return err
+		}
 
-		fmt.Printf("fetching %s (%v)\n", gom.name, customCmd)
-		err = run(customCmd, Blue)
+		fmt.Printf("%sfetching %s (%v)\n", gom.progress(), gom.name, customCmd)
+		err = runVCS(customCmd, nil)
 		if err != nil {
 			return err
 		}
 	} else if private, ok := gom.options["private"].(string); ok {
 		if private == "true" {
-			target, ok := gom.options["target"].(string)
-			if !ok {
-				target = gom.name
+			srcdir := filepath.Join(vendor, "src", gom.Target())
+			if _, err := os.Stat(srcdir); err == nil && !isCheckout(srcdir) {
+				// left by a clone that was interrupted
+				fmt.Printf("Warning: %s is not a complete checkout, cloning %s again\n", srcdir, gom.name)
+				if !*dryRun {
+					if err := os.RemoveAll(srcdir); err != nil {
+						return err
+					}
+				}
 			}
-			srcdir := filepath.Join(vendor, "src", target)
 			if _, err := os.Stat(srcdir); err != nil {
-				if err := os.MkdirAll(srcdir, 0755); err != nil {
-					return err
+				if !*dryRun {
+					if err := os.MkdirAll(srcdir, 0755); err != nil {
+						return err
+					}
 				}
 				if err := gom.clonePrivate(srcdir); err != nil {
 					return err
@@ -149,6 +586,29 @@ func (gom *Gom) Clone(args []string) error {
 				}
 			}
 		}
+	} else if gom.shallow() {
+		target := gom.Target()
+		if !has(gom.options, "target") {
+			target = gom.repoRoot()
+		}
+		srcdir := filepath.Join(vendor, "src", target)
+		if !isDir(srcdir) {
+			if err := gom.cloneShallow(srcdir); err != nil {
+				return err
+			}
+		}
+	} else if commit, ok := gom.options["commit"].(string); ok && !has(gom.options, "target") && !gom.insecure() {
+		// Fetching only the pinned commit is much faster than letting
+		// go get clone the whole history, which is all go get can do.
+		if url, ok := gom.gitURL(); ok {
+			srcdir := filepath.Join(vendor, "src", gom.repoRoot())
+			if !isDir(srcdir) {
+				if err := gom.fetchCommit(url, srcdir, commit); err != nil {
+					fmt.Printf("Warning: can't fetch commit %s of %s directly, cloning it instead\n", commit, gom.name)
+					os.RemoveAll(srcdir)
+				}
+			}
+		}
 	}
 
 	if skipdep, ok := gom.options["skipdep"].(string); ok {
@@ -157,10 +617,8 @@ func (gom *Gom) Clone(args []string) error {
 		}
 	}
 	cmdArgs := []string{"go", "get", "-d"}
-	if insecure, ok := gom.options["insecure"].(string); ok {
-		if insecure == "true" {
-			cmdArgs = append(cmdArgs, "-insecure")
-		}
+	if gom.insecure() {
+		cmdArgs = append(cmdArgs, "-insecure")
 	}
 	cmdArgs = append(cmdArgs, args...)
 	cmdArgs = append(cmdArgs, gom.name)
@@ -200,38 +658,154 @@ func (gom *Gom) Clone(args []string) error {
 	// Lastly there is the question of why 'gom install' is different from the other commands in exec.go.
 	// I would think all of them need to prepare the _vendor/ in the same way.
 
-	fmt.Printf("downloading %s\n", gom.name)
-	return run(cmdArgs, Blue)
+	fmt.Printf("%sdownloading %s\n", gom.progress(), gom.name)
+	_, private := gom.options["private"].(string)
+	if gom.Target() == gom.name || has(gom.options, "command") || private {
+		return gom.goGet(cmdArgs)
+	}
+	// go get fetches gom by its name, then it moves to its target
+	if isDir(filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target()))) {
+		return nil
+	}
+	if err := gom.goGet(cmdArgs); err != nil {
+		return err
+	}
+	return gom.moveToTarget(vendor)
 }
 
-func (gom *Gom) pullPrivate(srcdir string) (err error) {
-	cwd, err := os.Getwd()
+// moveToTarget moves the repository go get fetched gom into below the
+// vendor source directory to where gom's target says it goes.
+func (gom *Gom) moveToTarget(vendor string) error {
+	if *dryRun {
+		return nil
+	}
+	src := vendorSrc(vendor)
+	root, vcs := findVCS(src, gom.name)
+	if vcs == nil {
+		return fmt.Errorf("can't find the repository of %s in %s", gom.name, src)
+	}
+	rel, err := filepath.Rel(src, root)
 	if err != nil {
 		return err
 	}
-	if err := os.Chdir(srcdir); err != nil {
+	// the path of the package gom.name below its repository
+	sub := strings.TrimPrefix(gom.name, filepath.ToSlash(rel))
+	target := gom.Target()
+	if !strings.HasSuffix(target, sub) {
+		return fmt.Errorf("target %s of %s must end in %s, the path of the package in its repository", target, gom.name, sub)
+	}
+	dest := filepath.Join(src, filepath.FromSlash(strings.TrimSuffix(target, sub)))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
 		return err
 	}
-	defer os.Chdir(cwd)
+	fmt.Printf("moving %s to %s\n", gom.name, target)
+	return os.Rename(root, dest)
+}
+
+// commandData is what the templates of the command, ldflags and gcflags
+// options can refer to. Revision, the checked out revision, is only known
+// when building.
+type commandData struct {
+	Name     string
+	Target   string
+	Commit   string
+	Branch   string
+	Tag      string
+	Revision string
+	dir      string
+	usedDir  bool
+}
+
+// templateData returns the commandData of gom, whose directory is dir.
+func (gom *Gom) templateData(dir string) *commandData {
+	data := &commandData{Name: gom.name, Target: gom.Target(), dir: dir}
+	data.Commit, _ = gom.options["commit"].(string)
+	data.Branch, _ = gom.options["branch"].(string)
+	data.Tag, _ = gom.options["tag"].(string)
+	return data
+}
+
+// Dir returns the directory the command fetches into.
+func (d *commandData) Dir() string {
+	d.usedDir = true
+	return d.dir
+}
 
-	fmt.Printf("fetching private repo %s\n", gom.name)
-	pullCmd := "git pull origin master"
-	pullArgs := strings.Split(pullCmd, " ")
-	err = run(pullArgs, Blue)
+// customCommand returns the arguments of the command option, which is a
+// text/template such as "mytool fetch {{.Name}} {{.Commit}} {{.Dir}}".
+// Unless the template refers to {{.Dir}}, srcdir is appended, so a command
+// without any {{ }} runs as it always has.
+func (gom *Gom) customCommand(command, srcdir string) ([]string, error) {
+	if !strings.Contains(command, "{{") {
+		return append(strings.Split(command, " "), srcdir), nil
+	}
+	tmpl, err := template.New("command").Parse(command)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("%s: invalid command: %v", gom.name, err)
+	}
+	data := gom.templateData(srcdir)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%s: invalid command: %v", gom.name, err)
 	}
+	args := strings.Fields(buf.String())
+	if !data.usedDir {
+		args = append(args, srcdir)
+	}
+	return args, nil
+}
 
-	return
+// isCheckout reports whether dir is a checkout with a revision checked
+// out, unlike what an interrupted clone leaves.
+func isCheckout(dir string) bool {
+	switch vcs := vcsForDir(dir); vcs {
+	case nil:
+		return false
+	case git:
+		return vcsTest(dir, "git", "rev-parse", "-q", "--verify", "HEAD")
+	default:
+		return vcsTest(dir, vcs.revision...)
+	}
 }
 
-func (gom *Gom) clonePrivate(srcdir string) (err error) {
-	name := strings.Split(gom.name, "/")
-	privateUrl := fmt.Sprintf("git@%s:%s/%s", name[0], name[1], name[2])
+// privateVCS returns the VCS of gom's private repository at srcdir: the
+// one its vcs option names, or else the one of the clone already there,
+// or else git.
+func (gom *Gom) privateVCS(srcdir string) *vcsCmd {
+	if name, ok := gom.options["vcs"].(string); ok {
+		return vcsByName[name]
+	}
+	if vcs := vcsForDir(srcdir); vcs != nil {
+		return vcs
+	}
+	return git
+}
 
-	fmt.Printf("fetching private repo %s\n", gom.name)
-	cloneCmd := []string{"git", "clone", privateUrl, srcdir}
-	err = run(cloneCmd, Blue)
+func (gom *Gom) pullPrivate(srcdir string) (err error) {
+	fmt.Printf("%sfetching private repo %s\n", gom.progress(), gom.name)
+	url := gom.tokenURL()
+	if url == "" {
+		url = gom.privateURL()
+	}
+	switch gom.privateVCS(srcdir) {
+	case hg:
+		// -R rather than changing the directory, as with git below
+		return runVCS([]string{"hg", "pull", "-u", "-R", srcdir, url}, gom.fetchEnv())
+	case bzr:
+		return runVCS([]string{"bzr", "pull", "-d", srcdir, url}, gom.fetchEnv())
+	}
+	remote := gom.remote()
+	// -C rather than changing the directory of gom, which fetches others
+	// at the same time
+	pullArgs := []string{"git", "-C", srcdir, "pull", remote}
+	if url := gom.tokenURL(); url != "" {
+		// the token is kept out of the clone, so pass it again
+		pullArgs[4] = url
+	}
+	if branch := gom.pullBranch(srcdir, remote); branch != "" {
+		pullArgs = append(pullArgs, branch)
+	}
+	err = runVCS(pullArgs, gom.fetchEnv())
 	if err != nil {
 		return
 	}
@@ -239,107 +813,819 @@ func (gom *Gom) clonePrivate(srcdir string) (err error) {
 	return
 }
 
-func (gom *Gom) Checkout() error {
-	commit_or_branch_or_tag := ""
-	if has(gom.options, "branch") {
-		commit_or_branch_or_tag, _ = gom.options["branch"].(string)
-	}
-	if has(gom.options, "tag") {
-		commit_or_branch_or_tag, _ = gom.options["tag"].(string)
+// remote returns the name of the remote that gom's repository is cloned
+// from and its branches are fetched from, which is origin unless the
+// remote option says otherwise.
+func (gom *Gom) remote() string {
+	if remote, ok := gom.options["remote"].(string); ok {
+		return remote
 	}
-	if has(gom.options, "commit") {
-		commit_or_branch_or_tag, _ = gom.options["commit"].(string)
-	}
-	if commit_or_branch_or_tag == "" {
-		return nil
+	return "origin"
+}
+
+// pullBranch returns the branch to pull into the private repository at
+// srcdir: the branch option, or else the default branch of remote. It is
+// empty when neither is known, which leaves the choice to git pull.
+func (gom *Gom) pullBranch(srcdir, remote string) string {
+	if branch, ok := gom.options["branch"].(string); ok {
+		return branch
 	}
-	vendor, err := filepath.Abs(vendorFolder)
+	out, err := vcsOutput(srcdir, "git", "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD")
 	if err != nil {
-		return err
+		return ""
 	}
-	p := filepath.Join(vendor, "src")
-	target, ok := gom.options["target"].(string)
-	if !ok {
-		target = gom.name
+	return strings.TrimPrefix(strings.TrimSpace(out), remote+"/")
+}
+
+// repoRoot returns the import path of the repository holding gom: the
+// repo_root option, or else the path up to an element ending in .git, as
+// in example.com/group/repo.git/pkg, or else the first three elements,
+// which it is for the hosting sites gom knows about.
+func (gom *Gom) repoRoot() string {
+	if root, ok := gom.options["repo_root"].(string); ok {
+		return root
 	}
-	for _, elem := range strings.Split(target, "/") {
-		var vcs *vcsCmd
-		p = filepath.Join(p, elem)
-		if isDir(filepath.Join(p, ".git")) {
-			vcs = git
-		} else if isDir(filepath.Join(p, ".hg")) {
-			vcs = hg
-		} else if isDir(filepath.Join(p, ".bzr")) {
-			vcs = bzr
-		}
-		if vcs != nil {
-			p = filepath.Join(vendor, "src", target)
-			fmt.Printf("Checking out ref %s for %s\n", commit_or_branch_or_tag, target)
-			return vcs.Sync(p, commit_or_branch_or_tag)
+	name := strings.Split(gom.name, "/")
+	for i, elem := range name {
+		if i > 0 && strings.HasSuffix(elem, ".git") {
+			return strings.Join(name[:i+1], "/")
 		}
 	}
-	fmt.Printf("Warning: don't know how to checkout for %v\n", gom.name)
-	return errors.New("gom currently support git/hg/bzr for specifying tag/branch/commit")
+	if len(name) > 3 {
+		name = name[:3]
+	}
+	return strings.Join(name, "/")
 }
 
-func (gom *Gom) Build(args []string) error {
-	installCmd := append([]string{"go", "install"}, args...)
-	vendor, err := filepath.Abs(vendorFolder)
-	if err != nil {
-		return err
+// privateURL returns the URL a private repository is cloned from. SSH is
+// used unless the scheme option asks for https, a token is configured, or
+// a proxy is configured, since SSH connections don't go through HTTP proxies.
+// The ssh_host option replaces git@host, for example with a Host of
+// ~/.ssh/config.
+func (gom *Gom) privateURL() string {
+	root := strings.TrimSuffix(gom.repoRoot(), ".git")
+	host, path := root, ""
+	if i := strings.Index(root, "/"); i >= 0 {
+		host, path = root[:i], root[i+1:]
+	}
+	scheme, _ := gom.options["scheme"].(string)
+	if scheme == "https" || has(gom.options, "proxy") || has(gom.options, "token_env") {
+		return fmt.Sprintf("https://%s/%s", host, path)
 	}
-	target, ok := gom.options["target"].(string)
+	name, _ := gom.options["vcs"].(string)
+	sshHost, ok := gom.options["ssh_host"].(string)
+	switch {
+	case name == "hg" && ok:
+		return fmt.Sprintf("ssh://%s/%s", sshHost, path)
+	case name == "hg":
+		return fmt.Sprintf("ssh://hg@%s/%s", host, path)
+	case name == "bzr" && ok:
+		return fmt.Sprintf("bzr+ssh://%s/%s", sshHost, path)
+	case name == "bzr":
+		return fmt.Sprintf("bzr+ssh://%s/%s", host, path)
+	case ok:
+		return fmt.Sprintf("%s:%s", sshHost, path)
+	}
+	return fmt.Sprintf("git@%s:%s", host, path)
+}
+
+// tokenURL returns the https URL of a private repository with the token
+// for it, or "" when the URL isn't https or there is no token. The token
+// is read from the environment variable named by the token_env option,
+// GOM_GIT_TOKEN by default.
+func (gom *Gom) tokenURL() string {
+	url := gom.privateURL()
+	if !strings.HasPrefix(url, "https://") {
+		return ""
+	}
+	name, ok := gom.options["token_env"].(string)
 	if !ok {
-		target = gom.name
+		name = "GOM_GIT_TOKEN"
 	}
-	p := filepath.Join(vendor, "src", target)
-	return vcsExec(p, installCmd...)
+	token := os.Getenv(name)
+	if token == "" {
+		return ""
+	}
+	addSecret(token)
+	return "https://" + token + "@" + strings.TrimPrefix(url, "https://")
 }
 
-func isFile(p string) bool {
-	if fi, err := os.Stat(filepath.Join(p)); err == nil && !fi.IsDir() {
-		return true
+// netrcHelper is a git credential helper that answers with the login and
+// password of the host in the file $NETRC, since git only reads ~/.netrc.
+const netrcHelper = `!f() { test "$1" = get || exit 0; host=$(sed -n "s/^host=//p"); ` +
+	`awk -v host="$host" '{ for (i = 1; i < NF; i++) { if ($i == "machine") m = $(i+1); ` +
+	`if (m == host && $i == "login") print "username=" $(i+1); ` +
+	`if (m == host && $i == "password") print "password=" $(i+1) } }' "$NETRC"; }; f`
+
+// fetchEnv returns the environment for the commands fetching gom.
+func (gom *Gom) fetchEnv() []string {
+	var env []string
+	if proxy, ok := gom.options["proxy"].(string); ok {
+		for _, name := range []string{"http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY"} {
+			env = append(env, name+"="+proxy)
+		}
 	}
-	return false
+	if netrc, ok := gom.options["netrc"].(string); ok {
+		// the commands run in other directories
+		if abs, err := filepath.Abs(netrc); err == nil {
+			netrc = abs
+		}
+		env = append(env, "NETRC="+netrc,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0="+netrcHelper)
+	}
+	return env
 }
 
-func isDir(p string) bool {
-	if fi, err := os.Stat(filepath.Join(p)); err == nil && fi.IsDir() {
-		return true
+// gitHosts lists the hosts whose repositories are known to be git
+// repositories at https://host/owner/repo.
+var gitHosts = map[string]bool{
+	"bitbucket.org": true,
+	"github.com":    true,
+	"gitlab.com":    true,
+}
+
+// gitURL returns the URL of gom's repository when it is hosted on one of
+// gitHosts.
+func (gom *Gom) gitURL() (string, bool) {
+	root := gom.repoRoot()
+	name := strings.Split(root, "/")
+	if len(name) < 3 || !gitHosts[name[0]] {
+		return "", false
 	}
-	return false
+	return "https://" + root, true
 }
 
-func moveSrcToVendorSrc(vendor string) error {
-	vendorSrc := filepath.Join(vendor, "src")
-	dirs, err := readdirnames(vendor)
+// fetchCommit creates a git repository at srcdir holding only commit of
+// the repository at url, and checks it out. This needs git 2.5 or later
+// and a server that allows fetching commits by their SHA, as GitHub does;
+// on failure srcdir is left for the caller to remove.
+func (gom *Gom) fetchCommit(url, srcdir, commit string) error {
+	fmt.Printf("%sfetching %s (commit %s only)\n", gom.progress(), gom.name, commit)
+	if !*dryRun {
+		if err := os.MkdirAll(srcdir, 0755); err != nil {
+			return err
+		}
+	}
+	err := vcsExec(srcdir, "git", "init", "-q")
 	if err != nil {
 		return err
 	}
-	err = os.MkdirAll(vendorSrc, 0755)
+	err = vcsExec(srcdir, "git", "remote", "add", "origin", url)
 	if err != nil {
 		return err
 	}
-	for _, dir := range dirs {
-		if dir == "bin" || dir == "pkg" || dir == "src" {
-			continue
-		}
-		err = os.Rename(filepath.Join(vendor, dir), filepath.Join(vendorSrc, dir))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func moveSrcToVendor(vendor string) error {
-	vendorSrc := filepath.Join(vendor, "src")
-	dirs, err := readdirnames(vendorSrc)
+	err = git.FetchRevision(srcdir, gom.fetchEnv(), commit)
+	if err != nil {
+		return err
+	}
+	return vcsExec(srcdir, "git", "checkout", "-q", "FETCH_HEAD")
+}
+
+func (gom *Gom) clonePrivate(srcdir string) (err error) {
+	fmt.Printf("%sfetching private repo %s\n", gom.progress(), gom.name)
+	url := gom.tokenURL()
+	if url == "" {
+		url = gom.privateURL()
+	}
+	err = runVCS(gom.privateCloneCommand(url, srcdir), gom.fetchEnv())
+	if err != nil || url == gom.privateURL() || *dryRun {
+		return err
+	}
+	// don't leave the token in the vendor directory
+	switch gom.privateVCS(srcdir) {
+	case hg:
+		hgrc := "[paths]\ndefault = " + gom.privateURL() + "\n"
+		return ioutil.WriteFile(filepath.Join(srcdir, ".hg", "hgrc"), []byte(hgrc), 0644)
+	case bzr:
+		return vcsExec(srcdir, "bzr", "config", "parent_location="+gom.privateURL())
+	}
+	return vcsExec(srcdir, "git", "remote", "set-url", gom.remote(), gom.privateURL())
+}
+
+// privateCloneCommand returns the command cloning gom's private repository
+// from url into srcdir with its VCS. Only git clones take a remote and
+// a limited history.
+func (gom *Gom) privateCloneCommand(url, srcdir string) []string {
+	switch gom.privateVCS(srcdir) {
+	case hg:
+		return []string{"hg", "clone", url, srcdir}
+	case bzr:
+		// the directory is there already
+		return []string{"bzr", "branch", "--use-existing-dir", url, srcdir}
+	}
+	args := []string{"git", "clone", "--origin", gom.remote()}
+	if has(gom.options, "depth") || has(gom.options, "since") {
+		args = append(args, gom.shallowArgs()...)
+	}
+	return append(args, url, srcdir)
+}
+
+// shallow reports whether only the recent history of gom is cloned, which
+// is the case with the shallow option, a depth or a since date.
+func (gom *Gom) shallow() bool {
+	shallow, _ := gom.options["shallow"].(string)
+	return shallow == "true" || has(gom.options, "depth") || has(gom.options, "since")
+}
+
+// shallowArgs returns the arguments of git clone that limit the history to
+// the commits after the since option, or else to depth commits.
+func (gom *Gom) shallowArgs() []string {
+	if since, ok := gom.options["since"].(string); ok {
+		return []string{"--shallow-since", since}
+	}
+	return []string{"--depth", gom.depth()}
+}
+
+// depth returns the number of commits of history to clone, 1 unless the
+// depth option says otherwise.
+func (gom *Gom) depth() string {
+	if depth, ok := gom.options["depth"].(string); ok {
+		return depth
+	}
+	return "1"
+}
+
+// cloneShallow clones only the most recent history of gom's git repository.
+// A pinned tag or branch is cloned directly. A pinned commit is fetched
+// directly when the server allows it; otherwise, when the shallow history
+// does not contain it, the full history is fetched.
+func (gom *Gom) cloneShallow(srcdir string) error {
+	if commit, ok := gom.options["commit"].(string); ok {
+		err := gom.fetchCommit("https://"+gom.repoRoot(), srcdir, commit)
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("Warning: can't fetch commit %s of %s directly, cloning it instead\n", commit, gom.name)
+		os.RemoveAll(srcdir)
+	}
+
+	args := gom.shallowArgs()
+	if tag, ok := gom.options["tag"].(string); ok {
+		args = append(args, "--branch", tag)
+	} else if branch, ok := gom.options["branch"].(string); ok {
+		args = append(args, "--branch", branch)
+	}
+
+	fmt.Printf("%sfetching %s (shallow)\n", gom.progress(), gom.name)
+	err := gom.gitClone("https://"+gom.repoRoot(), srcdir, args...)
+	if err != nil {
+		return err
+	}
+
+	if commit, ok := gom.options["commit"].(string); ok {
+		if !vcsTest(srcdir, "git", "cat-file", "-e", commit+"^{commit}") {
+			fmt.Printf("Warning: commit %s of %s is not in the shallow clone, fetching full history\n", commit, gom.name)
+			return vcsExec(srcdir, "git", "fetch", "--unshallow")
+		}
+	}
+	return nil
+}
+
+func (gom *Gom) gitClone(url, srcdir string, args ...string) error {
+	cloneCmd := append([]string{"git", "clone"}, args...)
+	cloneCmd = append(cloneCmd, url, srcdir)
+	return runVCS(cloneCmd, gom.fetchEnv())
+}
+
+func (gom *Gom) Checkout() error {
+	if date, ok := gom.options["date"].(string); ok {
+		return gom.checkoutDate(date)
+	}
+	kind, ref := gom.pin()
+	if ref == "" {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	target := gom.Target()
+	if p, vcs := gom.findVCS(filepath.Join(vendor, "src")); vcs != nil {
+		if kind == "tag" && isTagPattern(ref) {
+			if vcs != git {
+				return errors.New("tag patterns are only supported for git")
+			}
+			refs, err := lsRemote(p)
+			if err != nil {
+				return err
+			}
+			tag, err := matchingTag(refs.tags(), ref)
+			if err != nil {
+				return fmt.Errorf("%s: %v", gom.name, err)
+			}
+			if *verbose {
+				fmt.Printf("tag %s of %s is %s\n", ref, gom.name, tag)
+			}
+			ref = tag
+		}
+		if gom.tracks() {
+			fmt.Printf("%sUpdating %s to the tip of branch %s\n", gom.progress(), target, ref)
+			return vcs.Track(p, gom.remote(), ref)
+		}
+		if kind == "bookmark" && vcs != hg {
+			return errors.New("bookmarks are only supported for Mercurial")
+		}
+		if vcs.checkout == nil {
+			// fine as long as the repository was fetched at the pin
+			if rev, err := vcs.Revision(p); err == nil && kind == "commit" && sameRevision(rev, ref) {
+				return nil
+			}
+			return fmt.Errorf("can't check out %s %s of %s; fetch it at that %s with :command", kind, ref, target, kind)
+		}
+		fmt.Printf("%sChecking out ref %s for %s\n", gom.progress(), ref, target)
+		return vcs.Sync(p, kind, ref)
+	}
+	if *dryRun {
+		// nothing has been cloned, so there is nothing to detect
+		fmt.Printf("%sChecking out ref %s for %s\n", gom.progress(), ref, target)
+		return nil
+	}
+	fmt.Printf("Warning: don't know how to checkout for %v\n", gom.name)
+	return errors.New("gom currently support git/hg/bzr/svn/fossil/darcs for specifying tag/branch/commit")
+}
+
+// checkoutDate checks out the last commit of gom before date, on its
+// branch or else the default branch of its remote. A shallow clone that
+// doesn't reach back that far is deepened.
+func (gom *Gom) checkoutDate(date string) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	p, vcs := gom.findVCS(vendorSrc(vendor))
+	if *dryRun && vcs == nil {
+		// nothing has been cloned, so there is nothing to detect
+		fmt.Printf("%sChecking out %s as of %s\n", gom.progress(), gom.Target(), date)
+		return nil
+	}
+	if vcs != git {
+		return fmt.Errorf("%s: checking out by :date is only supported for git", gom.name)
+	}
+	commit, err := gom.dateCommit(p, date)
+	if err != nil {
+		return err
+	}
+	if out, _ := vcsOutput(p, "git", "rev-parse", "--is-shallow-repository"); commit == "" && strings.TrimSpace(out) == "true" {
+		fmt.Printf("%sfetching the history of %s before %s\n", gom.progress(), gom.name, date)
+		if err := vcsExec(p, "git", "fetch", "-q", "--unshallow", gom.remote()); err != nil {
+			return err
+		}
+		if commit, err = gom.dateCommit(p, date); err != nil {
+			return err
+		}
+	}
+	if commit == "" {
+		return fmt.Errorf("%s has no commit before %s", gom.name, date)
+	}
+	fmt.Printf("%sChecking out %s as of %s (%s)\n", gom.progress(), gom.Target(), date, commit)
+	return vcs.Sync(p, "commit", commit)
+}
+
+// dateCommit returns the last commit of gom's branch, or else the default
+// branch of its remote, before date in the git repository at p, or "" if
+// there is none.
+func (gom *Gom) dateCommit(p, date string) (string, error) {
+	base := gom.remote() + "/HEAD"
+	if branch, ok := gom.options["branch"].(string); ok {
+		base = gom.remote() + "/" + branch
+	}
+	if !vcsTest(p, "git", "rev-parse", "-q", "--verify", base) {
+		// not cloned from a remote, as with :command
+		base = "HEAD"
+		if branch, ok := gom.options["branch"].(string); ok {
+			base = branch
+		}
+	}
+	out, err := vcsOutput(p, "git", "rev-list", "-1", "--before="+date, base)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", gom.name, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// floating reports whether gom moves upstream, which is when it is pinned
+// to a branch or bookmark, or not pinned at all.
+func (gom *Gom) floating() bool {
+	if has(gom.options, "date") {
+		return false
+	}
+	kind, _ := gom.pin()
+	return kind != "commit" && kind != "tag"
+}
+
+// updateFloating moves a floating gom to the latest revision of its branch
+// or bookmark, or to the latest revision go get finds, and prints where it
+// moved.
+func (gom *Gom) updateFloating() error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	p, vcs := gom.findVCS(filepath.Join(vendor, "src"))
+	if vcs == nil {
+		return gom.Checkout()
+	}
+	before, _ := vcs.Revision(p)
+
+	fmt.Printf("%sUpdating %s\n", gom.progress(), gom.name)
+	switch kind, ref := gom.pin(); kind {
+	case "branch":
+		err = vcs.Track(p, gom.remote(), ref)
+	case "bookmark":
+		err = vcs.UpdateRef(p, kind, ref)
+		if err == nil {
+			err = gom.Checkout()
+		}
+	default:
+		cmdArgs := []string{"go", "get", "-d", "-u"}
+		if gom.insecure() {
+			cmdArgs = append(cmdArgs, "-insecure")
+		}
+		err = gom.goGet(append(cmdArgs, gom.name))
+	}
+	if err != nil || *dryRun {
+		return err
+	}
+
+	after, err := vcs.Revision(p)
+	if err != nil {
+		return err
+	}
+	if !sameRevision(before, after) {
+		fmt.Printf("%s moved from %s to %s\n", gom.name, before, after)
+	} else if *verbose {
+		fmt.Printf("%s is up to date at %s\n", gom.name, after)
+	}
+	return nil
+}
+
+// tracks reports whether gom follows the tip of its branch, which is
+// fetched on every install.
+func (gom *Gom) tracks() bool {
+	track, ok := gom.options["track"].(string)
+	return ok && track == "true"
+}
+
+// Submodules initializes and updates the submodules of a git checkout
+// when the recursive option is set. Other VCSs are left alone.
+func (gom *Gom) Submodules() error {
+	if recursive, ok := gom.options["recursive"].(string); !ok || recursive != "true" {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	target := gom.Target()
+	p, vcs := gom.findVCS(filepath.Join(vendor, "src"))
+	if vcs != git {
+		return nil
+	}
+	fmt.Printf("Updating submodules for %s\n", target)
+	args := []string{"git", "submodule", "update", "--init", "--recursive"}
+	if has(gom.options, "depth") {
+		args = append(args, "--depth", gom.depth())
+	}
+	return vcsExec(p, args...)
+}
+
+// LFS fetches the Git LFS content of a git checkout when the lfs option is
+// set. Other VCSs are left alone.
+func (gom *Gom) LFS() error {
+	if lfs, ok := gom.options["lfs"].(string); !ok || lfs != "true" {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	target := gom.Target()
+	p, vcs := gom.findVCS(filepath.Join(vendor, "src"))
+	if vcs != git {
+		return nil
+	}
+	if !vcsTest(p, "git", "lfs", "version") {
+		return fmt.Errorf("%s needs git-lfs for its :lfs option, but git lfs isn't installed", gom.name)
+	}
+	fmt.Printf("Fetching LFS content for %s\n", target)
+	return vcsExecEnv(p, gom.fetchEnv(), "git", "lfs", "pull")
+}
+
+// PostInstall runs the shell command of the post_install option, such as
+// a make or code generation step, in gom's directory.
+func (gom *Gom) PostInstall() error {
+	hook, ok := gom.options["post_install"].(string)
+	if !ok || hook == "" {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("running post_install of %s\n", gom.name)
+	err = vcsExecEnv(filepath.Join(vendor, "src", gom.Target()), gom.buildEnv(), "sh", "-c", hook)
+	if err != nil {
+		return fmt.Errorf("post_install failed: %v", err)
+	}
+	return nil
+}
+
+// StripTests removes the test files and testdata directories below the
+// target of gom, if its strip_tests option is set, to keep the vendor
+// directory small. It runs once gom is built. A target that is a symlink,
+// to a checkout of your own, is left alone.
+func (gom *Gom) StripTests(vendor string) error {
+	strip, _ := gom.options["strip_tests"].(string)
+	if strip != "true" || gom.unchanged {
+		return nil
+	}
+	dir := filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target()))
+	if isSymlink(dir) {
+		return nil
+	}
+	fmt.Printf("stripping the tests of %s\n", gom.name)
+	if *dryRun {
+		return nil
+	}
+	var stripped []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case vcsMetadata[fi.Name()]:
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+		case fi.IsDir() && fi.Name() == "testdata":
+			stripped = append(stripped, p)
+			return filepath.SkipDir
+		case !fi.IsDir() && strings.HasSuffix(fi.Name(), "_test.go"):
+			stripped = append(stripped, p)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, p := range stripped {
+		if *verbose {
+			fmt.Printf("removing %s\n", p)
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findVCS walks up from target toward src and returns the first
+// directory holding VCS metadata along with its vcsCmd. That directory is
+// the root of the repository, which may be several levels above target.
+//
+// When target is, or is inside, a symlink to a checkout elsewhere, the
+// walk goes up from where the link points instead, for as many levels as
+// it would have gone up in src, and returns that directory.
+func findVCS(src, target string) (string, *vcsCmd) {
+	src = filepath.Clean(src)
+	p := filepath.Join(src, filepath.FromSlash(target))
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		real = p
+	}
+	for strings.HasPrefix(p, src+string(filepath.Separator)) {
+		if vcs := vcsForDir(real); vcs != nil {
+			if r, err := filepath.EvalSymlinks(p); err == nil && r == real {
+				// no symlink in between, keep the path in src
+				return p, vcs
+			}
+			return real, vcs
+		}
+		p, real = filepath.Dir(p), filepath.Dir(real)
+	}
+	return "", nil
+}
+
+// vcsByName lists the VCSs the vcs option may name.
+var vcsByName = map[string]*vcsCmd{
+	"git": git, "hg": hg, "bzr": bzr, "svn": svn, "fossil": fossil, "darcs": darcs,
+}
+
+// findVCS is findVCS for the target of gom in src, unless its vcs option
+// names the VCS. Then the repository is the target directory, whatever
+// metadata it has or lacks, as long as the directory is there.
+func (gom *Gom) findVCS(src string) (string, *vcsCmd) {
+	name, ok := gom.options["vcs"].(string)
+	if !ok {
+		return findVCS(src, gom.Target())
+	}
+	p := filepath.Join(src, filepath.FromSlash(gom.Target()))
+	if !isDir(p) {
+		return "", nil
+	}
+	return p, vcsByName[name]
+}
+
+func (gom *Gom) Build(args []string) error {
+	return gom.build(args, stdout, stderr)
+}
+
+func (gom *Gom) build(args []string, out, errOut io.Writer) error {
+	goCmd, err := gom.goCommand(out, errOut)
+	if err != nil {
+		return err
+	}
+	installCmd := []string{goCmd, "install"}
+	if tags := gom.buildTags(); len(tags) > 0 {
+		installCmd = append(installCmd, "-tags", strings.Join(tags, " "))
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	target := gom.Target()
+	p := filepath.Join(vendor, "src", target)
+	env := gom.buildEnv()
+	if goCmd != "go" {
+		// the toolchain finds its own GOROOT
+		env = append([]string{"GOROOT="}, env...)
+	}
+	flags, err := gom.buildFlags(vendor, p)
+	if err != nil {
+		return err
+	}
+	installCmd = append(installCmd, flags...)
+	installCmd = append(installCmd, args...)
+	installCmd = append(installCmd, gom.packages(target)...)
+	fmt.Printf("%sbuilding %s\n", gom.progress(), gom.name)
+	return vcsExecOut(p, env, out, errOut, installCmd...)
+}
+
+// buildFlags returns the -ldflags and -gcflags of the ldflags and gcflags
+// options of gom, whose package is at p. The options are text/templates, so
+// that for example {{.Revision}} can be baked into a version string.
+func (gom *Gom) buildFlags(vendor, p string) ([]string, error) {
+	var flags []string
+	for _, name := range []string{"ldflags", "gcflags"} {
+		value, ok := gom.options[name].(string)
+		if !ok {
+			continue
+		}
+		if strings.Contains(value, "{{") {
+			tmpl, err := template.New(name).Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s: %v", gom.name, name, err)
+			}
+			data := gom.templateData(p)
+			data.Revision = gom.revision(vendor)
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, fmt.Errorf("%s: invalid %s: %v", gom.name, name, err)
+			}
+			value = buf.String()
+		}
+		flags = append(flags, "-"+name+"="+value)
+	}
+	return flags, nil
+}
+
+// buildTags returns the build tags of the buildtags option, which may be
+// a list of symbols or a string of space or comma separated tags.
+func (gom *Gom) buildTags() []string {
+	switch tags := gom.options["buildtags"].(type) {
+	case []string:
+		return tags
+	case string:
+		return strings.FieldsFunc(tags, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return nil
+}
+
+// packages returns the import paths of the sub-packages of target listed
+// in the packages option, separated by spaces or commas. "." is target
+// itself.
+func (gom *Gom) packages(target string) []string {
+	list, ok := gom.options["packages"].(string)
+	if !ok {
+		return nil
+	}
+	var pkgs []string
+	for _, rel := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		pkgs = append(pkgs, path.Join(target, rel))
+	}
+	return pkgs
+}
+
+// re_env_sep matches the commas between the KEY=VALUE pairs of the env
+// option: those followed by the next KEY=, or by nothing.
+var re_env_sep = regexp.MustCompile(`,\s*(?:[A-Za-z_][A-Za-z0-9_]*=|$)`)
+
+// buildEnv returns the comma-separated KEY=VALUE pairs of the env option,
+// which are added to the environment of gom's build only. A value may hold
+// commas, as in CGO_LDFLAGS=-Wl,-rpath,/opt/lib.
+func (gom *Gom) buildEnv() []string {
+	env, ok := gom.options["env"].(string)
+	if !ok {
+		return nil
+	}
+	var vars []string
+	start := 0
+	add := func(kv string) {
+		if kv = strings.TrimSpace(kv); kv != "" {
+			vars = append(vars, kv)
+		}
+	}
+	for _, loc := range re_env_sep.FindAllStringIndex(env, -1) {
+		add(env[start:loc[0]])
+		start = loc[0] + 1
+	}
+	add(env[start:])
+	return vars
+}
+
+// isFile and isDir follow symlinks, so that a symlinked checkout is a
+// directory like any other. isSymlink tells links apart where that matters.
+func isFile(p string) bool {
+	if fi, err := os.Stat(filepath.Join(p)); err == nil && !fi.IsDir() {
+		return true
+	}
+	return false
+}
+
+func isDir(p string) bool {
+	if fi, err := os.Stat(filepath.Join(p)); err == nil && fi.IsDir() {
+		return true
+	}
+	return false
+}
+
+func isSymlink(p string) bool {
+	if fi, err := os.Lstat(p); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return true
+	}
+	return false
+}
+
+// moveSrcToVendorSrc moves the packages kept flat between commands into
+// the src directory of the vendor directory, where GOPATH finds them.
+func moveSrcToVendorSrc(vendor string) error {
+	if *dryRun {
+		return nil
+	}
+	flat := flatSrc(vendor)
+	defer cleanupStep("moving the packages of " + flatName(vendor) + " into " + vendorFolder + "/src")()
+	vendorSrc := filepath.Join(vendor, "src")
+	dirs, err := readdirnames(flat)
+	if os.IsNotExist(err) && flat != vendor {
+		// nothing was installed yet
+		movedToSrc = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(vendorSrc, 0755)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if flat == vendor && (dir == "bin" || dir == "pkg" || dir == "src" || dir == installStateFile) {
+			continue
+		}
+		err = moveDir(filepath.Join(flat, dir), filepath.Join(vendorSrc, dir))
+		if err != nil {
+			return err
+		}
+	}
+	movedToSrc = true
+	return nil
+}
+
+// moveSrcToVendor moves the packages back from the src directory of the
+// vendor directory to where they are kept flat between commands.
+func moveSrcToVendor(vendor string) error {
+	if *dryRun {
+		return nil
+	}
+	flat := flatSrc(vendor)
+	defer cleanupStep("moving the packages of " + vendorFolder + "/src back to " + flatName(vendor))()
+	vendorSrc := filepath.Join(vendor, "src")
+	dirs, err := readdirnames(vendorSrc)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(flat, 0755)
 	if err != nil {
 		return err
 	}
 	for _, dir := range dirs {
-		err = os.Rename(filepath.Join(vendorSrc, dir), filepath.Join(vendor, dir))
+		err = moveDir(filepath.Join(vendorSrc, dir), filepath.Join(flat, dir))
 		if err != nil {
 			return err
 		}
@@ -348,9 +1634,103 @@ func moveSrcToVendor(vendor string) error {
 	if err != nil {
 		return err
 	}
+	movedToSrc = false
 	return nil
 }
 
+// flatName returns the name of the directory the packages are kept flat
+// in, for messages.
+func flatName(vendor string) string {
+	if flatSrc(vendor) == vendor {
+		return vendorFolder
+	}
+	return flatVendorDir
+}
+
+// restoreMoved moves the packages back from vendor/src when gom was
+// interrupted, or failed, before it could do so, so that the next run
+// finds the vendor tree as it was.
+func restoreMoved() {
+	vendor, err := filepath.Abs(vendorFolder)
+	if !movedToSrc || err != nil || !isDir(filepath.Join(vendor, "src")) {
+		return
+	}
+	if rootCtx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "gom: interrupted, moving the packages of %s/src back to %s\n", vendorFolder, flatName(vendor))
+	}
+	err = moveSrcToVendor(vendor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gom: can't move %s/src back to %s: %v\n", vendorFolder, flatName(vendor), err)
+	}
+}
+
+// moveDir renames src to dst. When they are on different filesystems,
+// as vendor and vendor/src can be with overlayfs in Docker builds, src is
+// copied to dst instead and then removed.
+func moveDir(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("copying %s to %s\n", src, dst)
+	}
+	err = copyTree(src, dst)
+	if err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree copies the directory src to dst, keeping file modes and
+// symlinks as they are.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			err = os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			var link string
+			if link, err = os.Readlink(p); err == nil {
+				err = os.Symlink(link, target)
+			}
+		case fi.Mode().IsRegular():
+			err = copyFile(p, target, fi.Mode().Perm())
+		}
+		return err
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// the mode passed to OpenFile is subject to the umask
+	return os.Chmod(dst, mode)
+}
+
 func readdirnames(dirname string) ([]string, error) {
 	f, err := os.Open(dirname)
 	if err != nil {
@@ -364,8 +1744,73 @@ func readdirnames(dirname string) ([]string, error) {
 	return list, nil
 }
 
+// vendorEnv returns the GOPATH and GOBIN that gom builds with: the vendor
+// directory in front of GOPATH, and its bin directory or -gobin. With
+// -isolate GOPATH is the vendor directory alone, which makes any
+// dependency missing from the Gomfile fail instead of leaking in.
+func vendorEnv(vendor string) (string, string, error) {
+	gopath := vendor
+	if !*isolate {
+		gopath = prependPath(os.Getenv("GOPATH"), vendor)
+	}
+	gobin, err := gobinDir(vendor)
+	if err != nil {
+		return "", "", err
+	}
+	return gopath, gobin, nil
+}
+
+// setupVendorEnv sets GOPATH and GOBIN as vendorEnv returns them, so that
+// go get and go install work on the vendored packages.
+func setupVendorEnv(vendor string) error {
+	gopath, gobin, err := vendorEnv(vendor)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Printf("export GOPATH=%q\n", gopath)
+	}
+	err = os.Setenv("GOPATH", gopath)
+	if err != nil {
+		return err
+	}
+	if *gobinFlag != "" && !*dryRun {
+		// go install doesn't create a GOBIN that is missing
+		err = os.MkdirAll(gobin, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	if *verbose {
+		fmt.Printf("export GOBIN=%q\n", gobin)
+	}
+	return os.Setenv("GOBIN", gobin)
+}
+
+// gobinDir returns the directory binaries are installed into: the -gobin
+// directory, or bin in the vendor directory.
+func gobinDir(vendor string) (string, error) {
+	if *gobinFlag != "" {
+		return filepath.Abs(*gobinFlag)
+	}
+	return filepath.Join(vendor, "bin"), nil
+}
+
+// populate fetches and checks out the goms, leaving GOPATH and GOBIN as
+// they were.
 func populate(args []string) ([]Gom, error) {
-	allGoms, err := parseGomfile(*gomFileName)
+	defer saveEnv("GOPATH", "GOBIN")()
+	return populateGoms(args)
+}
+
+// populateGoms is populate, leaving GOPATH and GOBIN set up for building
+// the goms.
+func populateGoms(args []string) ([]Gom, error) {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return nil, err
+	}
+	err = validateGoms(allGoms)
 	if err != nil {
 		return nil, err
 	}
@@ -374,99 +1819,311 @@ func populate(args []string) ([]Gom, error) {
 		return nil, err
 	}
 	_, err = os.Stat(vendor)
-	if err != nil {
+	if err != nil && !*dryRun {
 		err = os.MkdirAll(vendor, 0755)
 		if err != nil {
 			return nil, err
 		}
 	}
-	if *verbose {
-		fmt.Printf("export GOPATH=%q\n", vendor)
-	}
-	err = os.Setenv("GOPATH", vendor)
+	err = setupVendorEnv(vendor)
 	if err != nil {
 		return nil, err
 	}
-	gobin := filepath.Join(vendor, "bin")
-	if *verbose {
-		fmt.Printf("export GOBIN=%q\n", gobin)
+
+	// glob goms stand for the repositories of their owner, or offline
+	// for those already vendored
+	list := listRepositories
+	if *offline {
+		list = vendoredRepositories(vendor)
 	}
-	err = os.Setenv("GOBIN", gobin)
+	allGoms, err = expandGlobs(allGoms, list)
+	if err != nil {
+		return nil, err
+	}
+	err = lockGoms(*gomFileName, allGoms)
 	if err != nil {
 		return nil, err
 	}
 
 	// 1. Filter goms to install
-	goms := make([]Gom, 0)
-	for _, gom := range allGoms {
-		if group, ok := gom.options["group"]; ok {
-			if !matchEnv(group) {
-				continue
-			}
+	goms := filterGoms(allGoms)
+	if len(onlyList) > 0 {
+		goms, err = onlyGoms(allGoms, goms, onlyList)
+		if err != nil {
+			return nil, err
 		}
-		if goos, ok := gom.options["goos"]; ok {
-			if !matchOS(goos) {
-				continue
-			}
+	}
+
+	if *offline {
+		err = checkInstalled(vendor, goms)
+		if err != nil {
+			return nil, err
 		}
-		goms = append(goms, gom)
 	}
 
-	if go15VendorExperimentEnv {
+	if flatSrc(vendor) != "" {
 		err = moveSrcToVendorSrc(vendor)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// 2. Clone the repositories
+	if *offline {
+		// build what is there without fetching or checking out anything
+		return goms, nil
+	}
+
+	// with -recursive-gomfile, the Gomfiles of the goms add more goms,
+	// unless the goms are already there
+	var failed gomErrors
+	var ready []Gom
+	seen := make(map[string]bool)
 	for _, gom := range goms {
-		err = gom.Clone(args)
+		seen[gom.name] = true
+	}
+	for len(goms) > 0 {
+		for i := range goms {
+			goms[i].index, goms[i].total = i+1, len(goms)
+		}
+		markUnchanged(vendor, goms, args)
+		fetched, errs, err := fetchGoms(vendor, goms, args)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, errs...)
+		ready = append(ready, fetched...)
+		if !*recursiveGomfile {
+			break
+		}
+		goms, err = dependencies(vendor, fetched, seen)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if len(failed) > 0 {
+		return ready, failed
+	}
+	return ready, nil
+}
+
+// fetchGoms clones and checks out goms. It returns the goms that are ready
+// to be built, and with -keep-going the failures of the others.
+func fetchGoms(vendor string, goms []Gom, args []string) ([]Gom, gomErrors, error) {
+	// 2. Clone the repositories, unless they are in the download cache
+	var cloned []Gom
+	var failed gomErrors
+	var err error
+	if *maxFetches > 1 {
+		cloned, failed, err = fetchParallel(vendor, goms, args)
+	} else {
+		cloned, failed, err = fetchSequential(vendor, goms, args)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// 3. Checkout the commit/branch/tag if needed
+	goms = make([]Gom, 0, len(cloned))
+	for _, gom := range cloned {
+		res, start := results.get(gom.name), time.Now()
+		var err error
+		if !gom.unchanged {
+			done := gom.prefixOutput()
+			err = gom.prepare(vendor)
+			done()
+			res.since("checkout", start)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			if !*keepGoing {
+				return nil, nil, err
+			}
+			failed = append(failed, gomError{gom.name, err})
+			continue
+		}
+		if *jsonOutput {
+			res.Revision = gom.revision(vendor)
+		}
+		goms = append(goms, gom)
+	}
+	return goms, failed, nil
+}
+
+// dependencies returns the goms listed by the Gomfiles at the root of the
+// repositories of goms which aren't seen yet, and marks them seen. Those
+// already seen, which includes every gom of our own Gomfile, keep their
+// pins, and cycles end there.
+func dependencies(vendor string, goms []Gom, seen map[string]bool) ([]Gom, error) {
+	var deps []Gom
 	for _, gom := range goms {
-		err = gom.Checkout()
+		filename := filepath.Join(gom.cacheSrcDir(vendor), "Gomfile")
+		if !isFile(filename) {
+			continue
+		}
+		allGoms, err := loadGomfile(filename)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %v", gom.name, err)
+		}
+		err = validateGoms(allGoms)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", gom.name, err)
+		}
+		allGoms, err = expandGlobs(allGoms, listRepositories)
+		if err == nil {
+			err = lockGoms(filename, allGoms)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", gom.name, err)
+		}
+		for _, dep := range filterGoms(allGoms) {
+			if seen[dep.name] {
+				continue
+			}
+			seen[dep.name] = true
+			fmt.Printf("%s requires %s\n", gom.name, dep.name)
+			deps = append(deps, dep)
 		}
 	}
+	return deps, nil
+}
 
-	return goms, nil
+// checkInstalled fails unless every gom is in the vendor directory.
+func checkInstalled(vendor string, goms []Gom) error {
+	for _, gom := range goms {
+		if !isDir(filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target()))) {
+			return fmt.Errorf("%s is not in %s; install it once without -offline", gom.name, vendorFolder)
+		}
+	}
+	return nil
 }
 
-func install(args []string) error {
-	goms, err := populate(args)
+// prepare checks out gom and runs the steps that follow a checkout.
+func (gom *Gom) prepare(vendor string) error {
+	var err error
+	switch {
+	case gom.module():
+		// go mod download fetched it at its version already
+	case *updateAll && gom.floating():
+		err = gom.updateFloating()
+	default:
+		err = gom.Checkout()
+	}
+	if err != nil {
+		return err
+	}
+	err = gom.Submodules()
 	if err != nil {
 		return err
 	}
+	err = gom.LFS()
+	if err != nil {
+		return err
+	}
+	err = gom.checkHash(vendor)
+	if err != nil {
+		return err
+	}
+	// cache the sources as checked out, without what the hook generates
+	err = gom.storeCache(vendor)
+	if err != nil {
+		return err
+	}
+	return gom.PostInstall()
+}
+
+// install installs the goms. With -json the progress goes to stderr, and
+// stdout gets the results as JSON. With -frozen nothing is installed, but
+// install fails unless that would change nothing.
+func install(args []string) error {
+	if *frozen {
+		return checkFrozen()
+	}
+	if *trace {
+		defer results.writeTrace(os.Stderr)
+	}
+	if !*jsonOutput {
+		return quietly(func() error { return installGoms(args) })
+	}
+	out := os.Stdout
+	os.Stdout, stdout = os.Stderr, os.Stderr
+	err := quietly(func() error { return installGoms(args) })
+	os.Stdout, stdout = out, out
+	return results.write(out, err)
+}
+
+func installGoms(args []string) error {
+	defer saveEnv("GOPATH", "GOBIN")()
+	defer restoreMoved()
+	goms, err := populateGoms(args)
+	failed, partial := err.(gomErrors)
+	if err != nil && !partial {
+		return err
+	}
 
 	// 4. Build and install
+	var builds []Gom
 	for _, gom := range goms {
 		if skipdep, ok := gom.options["skipdep"].(string); ok {
 			if skipdep == "true" {
 				continue
 			}
 		}
-		err = gom.Build(args)
+		builds = append(builds, gom)
+	}
+	var buildFailed gomErrors
+	if *parallelBuild {
+		buildFailed, err = buildParallel(builds, args)
+	} else {
+		buildFailed, err = buildGoms(builds, args)
+	}
+	if err != nil {
+		return err
+	}
+	failed = append(failed, buildFailed...)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	for _, gom := range goms {
+		if !failed.has(gom.name) {
+			err = gom.StripTests(vendor)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = saveInstallState(vendor, goms, failed, args)
+	if err != nil {
+		return err
+	}
+
+	// 5. Look for dependencies the Gomfile doesn't list, unless only
+	// some of the goms were installed
+	if len(failed) == 0 && len(onlyList) == 0 {
+		err = checkMissing()
 		if err != nil {
 			return err
 		}
 	}
 
-	if go15VendorExperimentEnv {
-		vendor, err := filepath.Abs(vendorFolder)
+	if flatSrc(vendor) != "" {
+		err = moveSrcToVendor(vendor)
 		if err != nil {
 			return err
 		}
-		err = moveSrcToVendor(vendor)
+	}
+
+	if *manifestFile != "" && len(failed) == 0 && !*dryRun {
+		err = writeManifest(*manifestFile, goms)
 		if err != nil {
 			return err
 		}
 	}
 
+	if len(failed) > 0 {
+		return failed
+	}
 	return nil
 }
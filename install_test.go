@@ -0,0 +1,1255 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRepoRoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-gtk", "github.com/mattn/go-gtk"},
+		{"github.com/mattn/go-gtk/gtk", "github.com/mattn/go-gtk"},
+		{"github.com/mattn/go-gtk/gdk/pixbuf", "github.com/mattn/go-gtk"},
+		{"example.com/lib", "example.com/lib"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: test.name, options: map[string]interface{}{}}
+		if root := gom.repoRoot(); root != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, root)
+		}
+	}
+}
+
+func TestVcsTest(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vcsTest(dir, "go", "version") {
+		t.Fatalf("Expected %v, but %v:", true, false)
+	}
+	if vcsTest(dir, "go", "no-such-command") {
+		t.Fatalf("Expected %v, but %v:", false, true)
+	}
+}
+
+func TestVcsForDir(t *testing.T) {
+	tests := []struct {
+		marker   string
+		dir      bool
+		expected *vcsCmd
+	}{
+		{".git", true, git},
+		{".hg", true, hg},
+		{".fslckout", false, fossil},
+		{"_FOSSIL_", false, fossil},
+		{".git", false, git},
+		{"", false, nil},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "gom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if test.marker != "" {
+			p := filepath.Join(dir, test.marker)
+			if test.dir {
+				err = os.Mkdir(p, 0755)
+			} else {
+				err = ioutil.WriteFile(p, nil, 0644)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if vcs := vcsForDir(dir); vcs != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, vcs)
+		}
+	}
+}
+
+func TestFossilRevisionMask(t *testing.T) {
+	info := "project-name: example\n" +
+		"checkout:     3a1e5f0b9c2d 2014-01-02 03:04:05 UTC\n" +
+		"parent:       9f8e7d6c5b4a 2014-01-01 03:04:05 UTC\n"
+	m := regexp.MustCompile(fossil.revisionMask).FindStringSubmatch(info)
+	if len(m) != 2 || m[1] != "3a1e5f0b9c2d" {
+		t.Fatalf("Expected %v, but %v:", "3a1e5f0b9c2d", m)
+	}
+}
+
+// gitRun runs git in dir with a fixed identity and file:// transport
+// allowed, so tests can build repositories and submodules locally.
+func gitRun(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=gom", "GIT_AUTHOR_EMAIL=gom@example.com",
+		"GIT_COMMITTER_NAME=gom", "GIT_COMMITTER_EMAIL=gom@example.com",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=protocol.file.allow", "GIT_CONFIG_VALUE_0=always")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, b)
+	}
+}
+
+// gitOutput runs git in dir and returns its trimmed output.
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	b, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %v: %v", args, err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// gitRepo creates a git repository in dir holding the given files in a
+// single commit.
+func gitRepo(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, dir, "init", "-q")
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun(t, dir, "add", "-A")
+	gitRun(t, dir, "commit", "-q", "-m", "initial")
+}
+
+func TestFindVCS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	root := filepath.Join(src, "example.com", "team", "monorepo")
+	err = os.MkdirAll(filepath.Join(root, ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(root, "sub", "pkg"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, vcs := findVCS(src, "example.com/team/monorepo/sub/pkg")
+	if vcs != git || p != root {
+		t.Fatalf("Expected git at %v, but %v:", root, p)
+	}
+
+	p, vcs = findVCS(src, "example.com/other/repo")
+	if vcs != nil {
+		t.Fatalf("Expected no VCS, but found one at %v:", p)
+	}
+
+	root = filepath.Join(src, "example.com", "sci", "lib")
+	err = os.MkdirAll(filepath.Join(root, "_darcs"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, vcs = findVCS(src, "example.com/sci/lib")
+	if vcs != darcs || p != root {
+		t.Fatalf("Expected darcs at %v, but %v:", root, p)
+	}
+
+	// a symlink to a subdirectory of a checkout outside src
+	outside := filepath.Join(dir, "work", "repo")
+	err = os.MkdirAll(filepath.Join(outside, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(outside, ".git"), []byte("gitdir: ../.git/worktrees/repo\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(src, "example.com", "linked", "repo"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(outside, "sub"), filepath.Join(src, "example.com", "linked", "repo", "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, vcs = findVCS(src, "example.com/linked/repo/sub")
+	if vcs != git || p != outside {
+		t.Fatalf("Expected git at %v, but %v:", outside, p)
+	}
+
+	// the vcs option wins over the metadata, or its absence
+	gom := Gom{name: "example.com/sci/lib", options: map[string]interface{}{"vcs": "git"}}
+	p, vcs = gom.findVCS(src)
+	if vcs != git || p != root {
+		t.Fatalf("Expected git at %v, but %v:", root, p)
+	}
+	gom = Gom{name: "example.com/team/monorepo/sub/pkg", options: map[string]interface{}{"vcs": "hg"}}
+	p, vcs = gom.findVCS(src)
+	if expected := filepath.Join(src, "example.com", "team", "monorepo", "sub", "pkg"); vcs != hg || p != expected {
+		t.Fatalf("Expected hg at %v, but %v:", expected, p)
+	}
+	gom = Gom{name: "example.com/other/repo", options: map[string]interface{}{"vcs": "git"}}
+	if p, vcs = gom.findVCS(src); vcs != nil {
+		t.Fatalf("Expected no VCS, but found one at %v:", p)
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, kv := range [][2]string{
+		{"GIT_CONFIG_COUNT", "1"},
+		{"GIT_CONFIG_KEY_0", "protocol.file.allow"},
+		{"GIT_CONFIG_VALUE_0", "always"},
+	} {
+		if v, ok := os.LookupEnv(kv[0]); ok {
+			defer os.Setenv(kv[0], v)
+		} else {
+			defer os.Unsetenv(kv[0])
+		}
+		os.Setenv(kv[0], kv[1])
+	}
+
+	sub := filepath.Join(dir, "sub")
+	gitRepo(t, sub, map[string]string{"sub.go": "package sub\n"})
+	parent := filepath.Join(dir, "parent")
+	gitRepo(t, parent, map[string]string{"parent.go": "package parent\n"})
+	gitRun(t, parent, "submodule", "add", "-q", sub, "sub")
+	gitRun(t, parent, "commit", "-q", "-m", "add submodule")
+
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	src := filepath.Join(vendorFolder, "src", "example.com")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, src, "clone", "-q", parent, "parent")
+	subFile := filepath.Join(src, "parent", "sub", "sub.go")
+
+	gom := Gom{name: "example.com/parent", options: map[string]interface{}{}}
+	if err := gom.Submodules(); err != nil {
+		t.Fatal(err)
+	}
+	if isFile(subFile) {
+		t.Fatalf("Expected %v, but %v:", false, true)
+	}
+
+	gom.options["recursive"] = "true"
+	if err := gom.Submodules(); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(subFile) {
+		t.Fatalf("Expected %v, but %v:", true, false)
+	}
+}
+
+func TestGomErrors(t *testing.T) {
+	errs := gomErrors{
+		{"github.com/a/a", errors.New("clone failed")},
+		{"github.com/b/b", errors.New("build failed")},
+	}
+	expected := "2 packages failed:\n  github.com/a/a: clone failed\n  github.com/b/b: build failed"
+	if errs.Error() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, errs.Error())
+	}
+}
+
+func TestPopulateKeepGoing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+
+	gomfile := filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(gomfile, []byte(`
+gom 'example.com/broken', :command => 'false', :skipdep => 'true'
+gom 'example.com/fine', :command => 'true', :skipdep => 'true'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = gomfile
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	defer func(v bool) { *keepGoing = v }(*keepGoing)
+
+	*keepGoing = false
+	_, err = populate(nil)
+	if _, ok := err.(gomErrors); err == nil || ok {
+		t.Fatalf("Expected %v, but %v:", "the first failure", err)
+	}
+
+	*keepGoing = true
+	goms, err := populate(nil)
+	failed, ok := err.(gomErrors)
+	if !ok || len(failed) != 1 || failed[0].name != "example.com/broken" {
+		t.Fatalf("Expected %v, but %v:", "example.com/broken to fail", err)
+	}
+	if len(goms) != 1 || goms[0].name != "example.com/fine" {
+		t.Fatalf("Expected %v, but %v:", "example.com/fine", goms)
+	}
+	if goms[0].progress() != "[2/2] " {
+		t.Fatalf("Expected %q, but %q:", "[2/2] ", goms[0].progress())
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	gom := Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{
+		"env": "CGO_CFLAGS=-I/opt/sqlite/include -DDEBUG, CC=clang,",
+	}}
+	expected := []string{"CGO_CFLAGS=-I/opt/sqlite/include -DDEBUG", "CC=clang"}
+	if env := gom.buildEnv(); !reflect.DeepEqual(env, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, env)
+	}
+
+	gom = Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{
+		"env": "CGO_LDFLAGS=-Wl,-rpath,/opt/lib -L/opt/lib,CGO_ENABLED=1, CC=clang",
+	}}
+	expected = []string{"CGO_LDFLAGS=-Wl,-rpath,/opt/lib -L/opt/lib", "CGO_ENABLED=1", "CC=clang"}
+	if env := gom.buildEnv(); !reflect.DeepEqual(env, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, env)
+	}
+
+	gom = Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}
+	if env := gom.buildEnv(); env != nil {
+		t.Fatalf("Expected no environment, but %q:", env)
+	}
+}
+
+func TestBuildTags(t *testing.T) {
+	gom := Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"buildtags": "libsqlite3, icu json1"}}
+	expected := []string{"libsqlite3", "icu", "json1"}
+	if tags := gom.buildTags(); !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, tags)
+	}
+
+	gom = Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"buildtags": []string{"libsqlite3", "icu"}}}
+	expected = []string{"libsqlite3", "icu"}
+	if tags := gom.buildTags(); !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, tags)
+	}
+}
+
+func TestSetupVendorEnv(t *testing.T) {
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v bool) { *isolate = v }(*isolate)
+	sep := string(filepath.ListSeparator)
+
+	tests := []struct {
+		isolate  bool
+		expected string
+	}{
+		{false, "/vendor" + sep + "/go"},
+		{true, "/vendor"},
+	}
+	for _, test := range tests {
+		os.Setenv("GOPATH", "/go")
+		*isolate = test.isolate
+		err := setupVendorEnv("/vendor")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gopath := os.Getenv("GOPATH"); gopath != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, gopath)
+		}
+		if gobin := os.Getenv("GOBIN"); gobin != filepath.Join("/vendor", "bin") {
+			t.Fatalf("Expected %v, but %v:", filepath.Join("/vendor", "bin"), gobin)
+		}
+	}
+}
+
+func TestBuildFlags(t *testing.T) {
+	gom := Gom{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{
+		"tag":     "v0.0.9",
+		"ldflags": "-s -w -X main.version={{.Tag}}",
+		"gcflags": "all=-N -l",
+	}}
+	expected := []string{"-ldflags=-s -w -X main.version=v0.0.9", "-gcflags=all=-N -l"}
+	flags, err := gom.buildFlags("/vendor", "/vendor/src/github.com/mattn/go-runewidth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, flags)
+	}
+}
+
+func TestPrivateURL(t *testing.T) {
+	tests := []struct {
+		options  map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"private": "true"}, "git@github.com:mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "scheme": "https"}, "https://github.com/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "proxy": "http://proxy:3128"}, "https://github.com/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "ssh_host": "github-work"}, "github-work:mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "vcs": "hg"}, "ssh://hg@github.com/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "vcs": "hg", "ssh_host": "hg-work"}, "ssh://hg-work/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "vcs": "bzr"}, "bzr+ssh://github.com/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "vcs": "hg", "scheme": "https"}, "https://github.com/mattn/go-gtk"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk/gtk", options: test.options}
+		if url := gom.privateURL(); url != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, url)
+		}
+	}
+
+	subgroups := []struct {
+		name     string
+		options  map[string]interface{}
+		expected string
+	}{
+		{"git.example.com/team/group/repo", map[string]interface{}{"repo_root": "git.example.com/team/group/repo"}, "git@git.example.com:team/group/repo"},
+		{"git.example.com/team/group/repo.git/pkg", map[string]interface{}{}, "git@git.example.com:team/group/repo"},
+		{"git.example.com/team/group/repo.git", map[string]interface{}{"scheme": "https"}, "https://git.example.com/team/group/repo"},
+	}
+	for _, test := range subgroups {
+		gom := Gom{name: test.name, options: test.options}
+		if url := gom.privateURL(); url != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, url)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+
+	gomfile := filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(gomfile, []byte(`
+gom 'example.com/repo', :command => 'false', :commit => '36e6bb17c1fb'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = gomfile
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	defer func(v bool) { *dryRun = v }(*dryRun)
+	*dryRun = true
+
+	err = install(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(vendorFolder); !os.IsNotExist(err) {
+		t.Fatalf("Expected %v, but %v:", "no vendor directory", err)
+	}
+	if !vcsTest(dir, "false") {
+		t.Fatalf("Expected %v, but %v:", true, false)
+	}
+}
+
+func TestGitURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-gtk/gtk", "https://github.com/mattn/go-gtk"},
+		{"gitlab.com/foo/bar", "https://gitlab.com/foo/bar"},
+		{"golang.org/x/net/context", ""},
+		{"github.com/mattn", ""},
+	}
+	for _, test := range tests {
+		gom := Gom{name: test.name, options: map[string]interface{}{}}
+		if url, _ := gom.gitURL(); url != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, url)
+		}
+	}
+}
+
+func TestFetchCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upstream := filepath.Join(dir, "upstream")
+	gitRepo(t, upstream, map[string]string{"a.go": "package a\n"})
+	commit := gitOutput(t, upstream, "rev-parse", "HEAD")
+	err = ioutil.WriteFile(filepath.Join(upstream, "b.go"), []byte("package a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "second")
+	bare := filepath.Join(dir, "upstream.git")
+	gitRun(t, dir, "clone", "-q", "--bare", upstream, bare)
+
+	srcdir := filepath.Join(dir, "src", "example.com", "repo")
+	gom := Gom{name: "example.com/repo", options: map[string]interface{}{"commit": commit}}
+	err = gom.fetchCommit("file://"+filepath.ToSlash(bare), srcdir, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(srcdir, "a.go")) || isFile(filepath.Join(srcdir, "b.go")) {
+		t.Fatalf("Expected %v, but %v:", "the files of "+commit, "another checkout")
+	}
+	if head := gitOutput(t, srcdir, "rev-parse", "HEAD"); head != commit {
+		t.Fatalf("Expected %v, but %v:", commit, head)
+	}
+}
+
+func TestCustomCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []string
+	}{
+		{"mytool fetch", []string{"mytool", "fetch", "/vendor/src/x"}},
+		{"mytool fetch {{.Name}} {{.Commit}}", []string{"mytool", "fetch", "example.com/x", "abc123", "/vendor/src/x"}},
+		{"mytool fetch -o {{.Dir}} {{.Target}} {{.Tag}}", []string{"mytool", "fetch", "-o", "/vendor/src/x", "example.com/x"}},
+		{"fetcher --dest={{.Dir}} {{.Name}}", []string{"fetcher", "--dest=/vendor/src/x", "example.com/x"}},
+		{"fetcher {{if .Tag}}--dest={{.Dir}}{{end}} {{.Name}}", []string{"fetcher", "example.com/x", "/vendor/src/x"}},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "example.com/x", options: map[string]interface{}{"commit": "abc123"}}
+		args, err := gom.customCommand(test.command, "/vendor/src/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, args)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "bin", "tool.sh"), []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("bin/tool.sh", filepath.Join(src, "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst")
+	err = copyTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "bin", "tool.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("Expected %v, but %v:", os.FileMode(0755), fi.Mode().Perm())
+	}
+	link, err := os.Readlink(filepath.Join(dst, "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "bin/tool.sh" {
+		t.Fatalf("Expected %v, but %v:", "bin/tool.sh", link)
+	}
+}
+
+func TestGobin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v string) { *gobinFlag = v }(*gobinFlag)
+	vendor := filepath.Join(dir, "_vendor")
+
+	*gobinFlag = ""
+	if gobin, err := gobinDir(vendor); err != nil || gobin != filepath.Join(vendor, "bin") {
+		t.Fatalf("Expected %v, but %v:", filepath.Join(vendor, "bin"), gobin)
+	}
+
+	*gobinFlag = filepath.Join(dir, "bin")
+	err = setupVendorEnv(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gobin := os.Getenv("GOBIN"); gobin != *gobinFlag {
+		t.Fatalf("Expected %v, but %v:", *gobinFlag, gobin)
+	}
+	if !isDir(*gobinFlag) {
+		t.Fatalf("Expected %v, but %v:", "the -gobin directory to be created", "none")
+	}
+}
+
+func TestTokenURL(t *testing.T) {
+	os.Setenv("GOM_TEST_TOKEN", "s3cret")
+	defer os.Unsetenv("GOM_TEST_TOKEN")
+	tests := []struct {
+		options  map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"private": "true"}, ""},
+		{map[string]interface{}{"private": "true", "token_env": "GOM_TEST_TOKEN"}, "https://s3cret@github.com/mattn/go-gtk"},
+		{map[string]interface{}{"private": "true", "token_env": "GOM_TEST_MISSING"}, ""},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk/gtk", options: test.options}
+		if url := gom.tokenURL(); url != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, url)
+		}
+	}
+	if s := redact("git clone https://s3cret@github.com/mattn/go-gtk"); s != "git clone https://***@github.com/mattn/go-gtk" {
+		t.Fatalf("Expected %v, but %v:", "git clone https://***@github.com/mattn/go-gtk", s)
+	}
+}
+
+func TestPostInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	pkg := filepath.Join(vendorFolder, "src", "example.com", "lib")
+	err = os.MkdirAll(pkg, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gom := Gom{name: "example.com/lib", options: map[string]interface{}{}}
+	err = gom.PostInstall()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gom.options["post_install"] = `echo "$GENERATED" > generated.go`
+	gom.options["env"] = "GENERATED=package lib"
+	err = gom.PostInstall()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(pkg, "generated.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package lib\n" {
+		t.Fatalf("Expected %q, but %q:", "package lib\n", string(b))
+	}
+
+	gom.options["post_install"] = "exit 1"
+	err = gom.PostInstall()
+	if err == nil || !strings.HasPrefix(err.Error(), "post_install failed") {
+		t.Fatalf("Expected %v, but %v:", "post_install failed", err)
+	}
+}
+
+func TestRef(t *testing.T) {
+	tests := []struct {
+		vcs      *vcsCmd
+		kind     string
+		expected string
+	}{
+		{hg, "bookmark", `bookmark("release")`},
+		{hg, "branch", `branch("release")`},
+		{hg, "commit", "release"},
+		{git, "branch", "release"},
+		{bzr, "commit", "revid:release"},
+	}
+	for _, test := range tests {
+		if ref := test.vcs.Ref(test.kind, "release"); ref != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, ref)
+		}
+	}
+	for _, revno := range []string{"42", "1.2.3"} {
+		if ref := bzr.Ref("commit", revno); ref != revno {
+			t.Fatalf("Expected %v, but %v:", revno, ref)
+		}
+	}
+}
+
+func TestUpdateRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a VCS that leaves a file named after what it pulled
+	vcs := &vcsCmd{update: []string{"touch", "all"}, pullBookmark: []string{"touch"}}
+	tests := []struct {
+		kind     string
+		expected string
+	}{
+		{"bookmark", "release"},
+		{"branch", "all"},
+	}
+	for _, test := range tests {
+		err = vcs.UpdateRef(dir, test.kind, "release")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isFile(filepath.Join(dir, test.expected)) {
+			t.Fatalf("Expected %v to be pulled, but it wasn't:", test.expected)
+		}
+		os.Remove(filepath.Join(dir, test.expected))
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		vcs      *vcsCmd
+		out      string
+		expected string
+	}{
+		{git, "0123456789abcdef\n", "0123456789abcdef"},
+		{bzr, "42 john@example.com-20200102030405-0123456789abcdef\n", "john@example.com-20200102030405-0123456789abcdef"},
+		{svn, "Path: .\nRevision: 1234\nNode Kind: directory\n", "1234"},
+	}
+	for _, test := range tests {
+		if rev := test.vcs.mask(test.out); rev != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, rev)
+		}
+	}
+}
+
+func TestPopulateOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+
+	gomfile := filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(gomfile, []byte(`
+gom 'example.com/lib', :command => 'false', :commit => '36e6bb17c1fb'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = gomfile
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	defer func(v bool) { *offline = v }(*offline)
+	*offline = true
+
+	_, err = populate(nil)
+	if err == nil || !strings.Contains(err.Error(), "install it once without -offline") {
+		t.Fatalf("Expected %v, but %v:", "example.com/lib to be missing", err)
+	}
+
+	// neither cloned nor checked out, or the command and checkout would fail
+	err = os.MkdirAll(filepath.Join(vendorFolder, "src", "example.com", "lib"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms, err := populate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goms) != 1 || goms[0].name != "example.com/lib" {
+		t.Fatalf("Expected %v, but %v:", "example.com/lib", goms)
+	}
+}
+
+func TestFetchEnvNetrc(t *testing.T) {
+	gom := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"netrc": "/etc/gom/netrc"}}
+	env := gom.fetchEnv()
+	expected := []string{"NETRC=/etc/gom/netrc", "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=credential.helper", "GIT_CONFIG_VALUE_0=" + netrcHelper}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, env)
+	}
+}
+
+func TestCloneMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	defer os.Setenv("GOBIN", os.Getenv("GOBIN"))
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+
+	mirror := filepath.Join(dir, "mirror")
+	gitRepo(t, mirror, map[string]string{"lib.go": "package lib\n"})
+
+	// the regular fetch fails, so gom falls back to the mirror
+	gom := Gom{name: "example.com/flaky/lib", options: map[string]interface{}{
+		"command": "false",
+		"skipdep": "true",
+	}}
+	if err := gom.Clone(nil); err == nil {
+		t.Fatalf("Expected %v, but %v:", "an error", err)
+	}
+	gom.options["mirror"] = mirror
+	err = gom.Clone(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(vendorFolder, "src", "example.com", "flaky", "lib", "lib.go")) {
+		t.Fatalf("Expected %v, but %v:", "a clone of the mirror", "none")
+	}
+}
+
+func TestPackages(t *testing.T) {
+	gom := Gom{name: "github.com/golang/protobuf", options: map[string]interface{}{"packages": "., protoc-gen-go"}}
+	expected := []string{"github.com/golang/protobuf", "github.com/golang/protobuf/protoc-gen-go"}
+	if pkgs := gom.packages(gom.name); !reflect.DeepEqual(pkgs, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, pkgs)
+	}
+
+	gom = Gom{name: "github.com/golang/protobuf", options: map[string]interface{}{}}
+	if pkgs := gom.packages(gom.name); pkgs != nil {
+		t.Fatalf("Expected no packages, but %q:", pkgs)
+	}
+}
+
+func TestLFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	src := filepath.Join(vendorFolder, "src", "example.com")
+	gitRepo(t, filepath.Join(src, "assets"), map[string]string{"a.go": "package assets\n"})
+	err = os.MkdirAll(filepath.Join(src, "hgrepo", ".hg"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without the option, or for another VCS, there is nothing to do
+	gom := Gom{name: "example.com/assets", options: map[string]interface{}{}}
+	if err := gom.LFS(); err != nil {
+		t.Fatal(err)
+	}
+	gom = Gom{name: "example.com/hgrepo", options: map[string]interface{}{"lfs": "true"}}
+	if err := gom.LFS(); err != nil {
+		t.Fatal(err)
+	}
+
+	if vcsTest(dir, "git", "lfs", "version") {
+		t.Skip("git-lfs is installed")
+	}
+	gom = Gom{name: "example.com/assets", options: map[string]interface{}{"lfs": "true"}}
+	err = gom.LFS()
+	if err == nil || !strings.Contains(err.Error(), "git lfs isn't installed") {
+		t.Fatalf("Expected %v, but %v:", "git lfs isn't installed", err)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	dir := filepath.Join(vendor, "src", "example.com", "a")
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "Gomfile"), []byte("gom 'example.com/a'\ngom 'example.com/b', :tag => 'v1'\ngom 'example.com/c'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms := []Gom{{name: "example.com/a", options: map[string]interface{}{"target": "example.com/a"}}}
+	seen := map[string]bool{"example.com/a": true, "example.com/c": true}
+	deps, err := dependencies(vendor, goms, seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{{name: "example.com/b", options: map[string]interface{}{"tag": "v1"}}}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, deps)
+	}
+	if !seen["example.com/b"] {
+		t.Fatalf("Expected %v to be seen", "example.com/b")
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	defer func() { *insecureFlag = false }()
+	tests := []struct {
+		flag     bool
+		options  map[string]interface{}
+		expected bool
+	}{
+		{false, map[string]interface{}{}, false},
+		{false, map[string]interface{}{"insecure": "true"}, true},
+		{true, map[string]interface{}{}, true},
+		{true, map[string]interface{}{"insecure": "false"}, false},
+	}
+	for _, test := range tests {
+		*insecureFlag = test.flag
+		gom := Gom{name: "git.internal/team/lib", options: test.options}
+		if insecure := gom.insecure(); insecure != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, insecure)
+		}
+	}
+}
+
+func TestRemote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(folder string) { vendorFolder = folder }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+
+	upstream := filepath.Join(dir, "upstream")
+	gitRepo(t, upstream, map[string]string{"a.go": "package a\n"})
+	gitRun(t, upstream, "checkout", "-q", "-b", "dev")
+	srcdir := filepath.Join(vendorFolder, "src", "example.com", "repo")
+	gitRun(t, dir, "clone", "-q", "-o", "upstream", upstream, srcdir)
+	commit := func(file string) string {
+		err := ioutil.WriteFile(filepath.Join(upstream, file), []byte("package a\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gitRun(t, upstream, "add", "-A")
+		gitRun(t, upstream, "commit", "-q", "-m", file)
+		return gitOutput(t, upstream, "rev-parse", "HEAD")
+	}
+
+	gom := Gom{name: "example.com/repo", options: map[string]interface{}{}}
+	if remote := gom.remote(); remote != "origin" {
+		t.Fatalf("Expected %v, but %v:", "origin", remote)
+	}
+	gom.options["remote"] = "upstream"
+	if remote := gom.remote(); remote != "upstream" {
+		t.Fatalf("Expected %v, but %v:", "upstream", remote)
+	}
+	if branch := gom.pullBranch(srcdir, "upstream"); branch != "dev" {
+		t.Fatalf("Expected %v, but %v:", "dev", branch)
+	}
+
+	// a tracked branch moves to the tip of the configured remote
+	tip := commit("b.go")
+	gom.options["branch"] = "dev"
+	gom.options["track"] = "true"
+	err = gom.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := gitOutput(t, srcdir, "rev-parse", "HEAD"); head != tip {
+		t.Fatalf("Expected %v, but %v:", tip, head)
+	}
+
+	// and verify compares with the branch fetched from that remote
+	fetched := commit("c.go")
+	gitRun(t, srcdir, "fetch", "-q", "upstream")
+	d, err := gom.checkRevision(vendorFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.expected != fetched || d.actual != tip {
+		t.Fatalf("Expected %v, but %v:", fetched, d)
+	}
+}
+
+func TestIsCheckout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	empty := filepath.Join(dir, "empty")
+	err = os.MkdirAll(empty, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an interrupted clone leaves a repository without a commit
+	interrupted := filepath.Join(dir, "interrupted")
+	gitRun(t, dir, "init", "-q", interrupted)
+	complete := filepath.Join(dir, "complete")
+	gitRepo(t, complete, map[string]string{"a.go": "package a\n"})
+
+	tests := []struct {
+		dir      string
+		expected bool
+	}{
+		{filepath.Join(dir, "missing"), false},
+		{empty, false},
+		{interrupted, false},
+		{complete, true},
+	}
+	for _, test := range tests {
+		if actual := isCheckout(test.dir); actual != test.expected {
+			t.Fatalf("Expected %v, but %v: %s", test.expected, actual, test.dir)
+		}
+	}
+}
+
+func TestMoveToTarget(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	err = os.MkdirAll(filepath.Join(vendor, "src", "mirror.example.com", "r", ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(vendor, "src", "mirror.example.com", "r", "x"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gom := Gom{name: "mirror.example.com/r/x", options: map[string]interface{}{"target": "example.com/r/x"}}
+	err = gom.moveToTarget(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isDir(filepath.Join(vendor, "src", "example.com", "r", "x")) {
+		t.Fatalf("Expected %v to be moved to its target", gom.name)
+	}
+
+	err = os.MkdirAll(filepath.Join(vendor, "src", "mirror.example.com", "s", ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gom = Gom{name: "mirror.example.com/s/x", options: map[string]interface{}{"target": "example.com/s/y"}}
+	if err = gom.moveToTarget(vendor); err == nil {
+		t.Fatalf("Expected an error for target %v, but none", gom.Target())
+	}
+}
+
+func TestFlatVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	*flatVendor = true
+	defer func() { *flatVendor = false }()
+
+	vendor := filepath.Join(dir, "_vendor")
+	flat := filepath.Join(dir, flatVendorDir)
+	err = os.MkdirAll(filepath.Join(flat, "example.com", "a"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := vendorSrc(vendor); p != flat {
+		t.Fatalf("Expected %v, but %v:", flat, p)
+	}
+	err = moveSrcToVendorSrc(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := vendorSrc(vendor); p != filepath.Join(vendor, "src") {
+		t.Fatalf("Expected %v, but %v:", filepath.Join(vendor, "src"), p)
+	}
+	if !isDir(filepath.Join(vendor, "src", "example.com", "a")) || isDir(filepath.Join(flat, "example.com")) {
+		t.Fatalf("Expected example.com/a to be moved into %v", filepath.Join(vendor, "src"))
+	}
+	err = moveSrcToVendor(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isDir(filepath.Join(flat, "example.com", "a")) || isDir(filepath.Join(vendor, "src")) {
+		t.Fatalf("Expected example.com/a to be moved back to %v", flat)
+	}
+	if p := vendorSrc(vendor); p != flat {
+		t.Fatalf("Expected %v, but %v:", flat, p)
+	}
+}
+
+func TestFindUnfetched(t *testing.T) {
+	output := `package example.com/gone: unrecognized import path "example.com/gone": https fetch: Get "https://example.com/gone?go-get=1": 404 Not Found
+cannot find package "github.com/mattn/go-missing" in any of:
+	/usr/local/go/src/github.com/mattn/go-missing (from $GOROOT)
+package example.com/gone: unrecognized import path "example.com/gone"
+`
+	err := findUnfetched(output)
+	expected := unfetchedError{
+		{"example.com/gone", "unrecognized import path"},
+		{"github.com/mattn/go-missing", "cannot find package"},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, err)
+	}
+	if err := findUnfetched("github.com/mattn/go-sqlite3 (download)\n"); err != nil {
+		t.Fatalf("Expected no error, but %v:", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	defer func() { *retries = 0 }()
+	*retries = 2
+	gom := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}
+	if n := gom.retries(); n != 2 {
+		t.Fatalf("Expected %v, but %v:", 2, n)
+	}
+	gom.options["retries"] = "5"
+	if n := gom.retries(); n != 5 {
+		t.Fatalf("Expected %v, but %v:", 5, n)
+	}
+	gom.options["retries"] = "0"
+	if n := gom.retries(); n != 0 {
+		t.Fatalf("Expected %v, but %v:", 0, n)
+	}
+}
+
+func TestPopulateHashedLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	err = ioutil.WriteFile(filepath.Join(dir, "Gomfile"), []byte("gom 'github.com/mattn/go-gtk', :branch => 'master'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as gom lock -hash writes it
+	err = ioutil.WriteFile(filepath.Join(dir, "Gomfile.lock"), []byte("gom 'github.com/mattn/go-gtk', :commit => 'asdfasdf', :sha256 => '"+sum+"'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "_vendor", "src", "github.com", "mattn", "go-gtk"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	oldVendor, oldGomfile := vendorFolder, *gomFileName
+	vendorFolder, *gomFileName, *offline = "_vendor", "Gomfile", true
+	defer func() { vendorFolder, *gomFileName, *offline = oldVendor, oldGomfile, false }()
+
+	goms, err := populate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"commit": "asdfasdf", "sha256": sum}
+	if len(goms) != 1 || !reflect.DeepEqual(goms[0].options, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestPrivateCloneCommand(t *testing.T) {
+	tests := []struct {
+		options  map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{"private": "true"}, []string{"git", "clone", "--origin", "origin", "URL", "/src"}},
+		{map[string]interface{}{"private": "true", "depth": "1"}, []string{"git", "clone", "--origin", "origin", "--depth", "1", "URL", "/src"}},
+		{map[string]interface{}{"private": "true", "vcs": "hg"}, []string{"hg", "clone", "URL", "/src"}},
+		{map[string]interface{}{"private": "true", "vcs": "bzr"}, []string{"bzr", "branch", "--use-existing-dir", "URL", "/src"}},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "example.com/team/repo", options: test.options}
+		if args := gom.privateCloneCommand("URL", "/src"); !reflect.DeepEqual(args, test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, args)
+		}
+	}
+}
+
+func TestStripTests(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	files := []string{
+		"a.go", "a_test.go", "testdata/in.txt", "sub/b.go", "sub/b_test.go", "sub/testdata/deep/out.txt",
+		".git/hooks/x_test.go", "other/c_test.go",
+	}
+	for _, file := range files {
+		root := "example.com/a"
+		if file == "other/c_test.go" {
+			root = "example.com"
+		}
+		p := filepath.Join(vendor, "src", filepath.FromSlash(root), filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gom := Gom{name: "example.com/a", options: map[string]interface{}{"strip_tests": "true"}}
+	err = gom.StripTests(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{"example.com/a/a.go", true},
+		{"example.com/a/a_test.go", false},
+		{"example.com/a/testdata", false},
+		{"example.com/a/sub/b.go", true},
+		{"example.com/a/sub/b_test.go", false},
+		{"example.com/a/sub/testdata", false},
+		{"example.com/a/.git/hooks/x_test.go", true},
+		{"example.com/other/c_test.go", true},
+	}
+	for _, test := range tests {
+		_, err := os.Lstat(filepath.Join(vendor, "src", filepath.FromSlash(test.file)))
+		if exists := err == nil; exists != test.expected {
+			t.Fatalf("Expected %v, but %v: %s", test.expected, exists, test.file)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func usage() {
@@ -14,25 +15,110 @@ func usage() {
    gom build   [options]   : Build with _vendor packages
    gom install [options]   : Install bundled packages into _vendor directory, by default.
                               GOM_VENDOR_NAME=. gom install [options], for regular src folder.
-   gom test    [options]   : Run tests with bundles
-   gom run     [options]   : Run go file with bundles
-   gom doc     [options]   : Run godoc for bundles
-   gom exec    [arguments] : Execute command with bundle environment
+   gom update  IMPORTPATH  : Fetch, checkout and rebuild a single bundled package
+   gom test [-update] [packages] [-- flags]
+                           : Run tests with bundles, on ./... by default; -update
+                              populates the bundles first
+   gom run [package] [-- args]
+                           : Run a main package, . by default, with bundles; args after --
+                              go to the program
+   gom doc IMPORTPATH [symbol]
+                           : Show the documentation of a bundled package
+   gom exec [--] command [arguments]
+                           : Execute command with bundle environment
    gom tool    [options]   : Run go tool with bundles
-   gom env     [arguments] : Run go env
+   gom env [-json | arguments]
+                           : Print the GOPATH, GOBIN, PATH and vendor directory of gom as
+                              shell exports, or as JSON; with other arguments, run go env
    gom fmt     [arguments] : Run go fmt
    gom list    [arguments] : Run go list
    gom vet     [arguments] : Run go vet
    gom gen travis-yml      : Generate .travis.yml which uses "gom test"
-   gom gen gomfile         : Scan packages from current directory as root
-                              recursively, and generate Gomfile
-   gom lock                : Generate Gomfile.lock
+   gom gen github-actions [-o FILE]
+                           : Generate .github/workflows/gom.yml which uses "gom test", for
+                              every system and group the Gomfile names
+   gom gen gomfile [-o FILE]
+                           : Print a Gomfile listing the dependencies of the packages
+                              below the current directory, pinned to the commits in GOPATH
+   gom lock [-hash]        : Generate Gomfile.lock; -hash records the SHA-256 of the
+                              sources of each package, which install then checks
+   gom freeze [-o FILE]    : Pin every installed package to its commit in the Gomfile itself,
+                              or write the result to FILE, or stdout if FILE is -
+   gom check               : Check the syntax and the options of the Gomfile and its lock
+                              file, without fetching or changing anything
+   gom verify              : Check that bundled packages are at their pinned revisions
+   gom tree                : Show which bundled packages import which
+   gom status              : Show the revision of every bundled package, whether it has
+                              uncommitted changes, and whether it is at its pin
+   gom which IMPORTPATH    : Print the directory IMPORTPATH is vendored in, and then its
+                              revision or "not installed"
+   gom info IMPORTPATH     : Show how the options of the package IMPORTPATH resolve: its
+                              vendor path, pin, groups, platforms and fetch commands
+   gom outdated            : Show newer tags and commits upstream of pinned git packages
    gom populate            : Populate _vendor package source
+   gom clean [-all] [-f]   : Remove the bundled packages, and with -all the installed
+                              binaries, asking first unless -f is given
+   gom prune [-f] [-dry-run]
+                           : Remove the bundled repositories that neither the Gomfile nor
+                              their imports need any more, asking first unless -f is given
 
  Options:
    -v                      : enable verbosity
-   -f FILE                 : use FILE as Gomfile
-   -groups GROUPS          : comma-separaated list of Gomfile groups
+   -q, -quiet              : print nothing but errors; what the commands gom runs print is
+                              shown only when it fails
+   -trace                  : print when every command gom runs starts and ends and how long it
+                              took, and after install how long each package took to clone,
+                              check out and build, the slowest first, on stderr
+   -f FILE                 : use FILE as Gomfile, or read it from stdin if FILE is -
+   -groups GROUPS          : comma-separaated list of Gomfile groups (or $GOM_GROUPS)
+   -without GROUPS         : comma-separated list of Gomfile groups to leave out, even if
+                              selected otherwise (or $GOM_WITHOUT)
+   -no-cache               : neither use nor fill the download cache
+   -keep-going             : install every package even if some fail, then report the failures
+   -isolate                : install with GOPATH set to the vendor directory only
+   -dry-run                : print the commands that would run, but don't run them
+   -strict                 : fail install when imports are missing from the vendor directory
+   -json                   : print the results of install as JSON on stdout, and the
+                              progress on stderr
+   -offline                : install from the vendor directory as it is, without fetching
+                              or checking out anything
+   -recursive-gomfile      : also install the packages the Gomfiles of the packages list,
+                              unless the Gomfile already lists them
+   -insecure               : let go get fetch over http and without checking certificates, for
+                              every package without :insecure => 'false'. Anyone on the
+                              network path can then replace the sources you build
+   -update-all             : move every package pinned to a branch or bookmark, or not pinned,
+                              to its latest revision, and print which ones moved
+   -only IMPORTPATH        : install only the package IMPORTPATH of the Gomfile, and what
+                              go get fetches for it; may be given more than once
+   -max-concurrent-fetches N
+                           : fetch up to N packages at once (default 1); go get still runs
+                              for one package at a time
+   -max-host-fetches N     : with -max-concurrent-fetches, fetch up to N packages at once
+                              from the same host (default 4)
+   -parallel-build         : build the packages that don't import each other at the same time,
+                              each after the ones it imports, one per CPU
+   -manifest FILE          : after installing, write the import path, VCS, revision and
+                              fetch URL of every package to FILE as JSON, for provenance
+   -force                  : install every package again, even those pinned to a commit, tag or
+                              date that are unchanged since the last install
+   -frozen                 : only check that every package is installed at its pinned
+                              revision, and fail listing the ones that aren't
+   -vendor-experiment MODE : lay out the vendor directory for the go1.5 vendor experiment if
+                              MODE is on, or not if it is off; auto, the default, does so
+                              when GO15VENDOREXPERIMENT is set
+   -vendor DIR             : use DIR as the vendor directory instead of _vendor (or $GOM_VENDOR)
+   -flat-vendor            : keep the packages in ./vendor by their import paths, where go
+                              build finds them, and move them into the vendor directory
+                              only while gom runs go commands on them
+   -no-color               : disable colored output, as does setting NO_COLOR
+   -gobin DIR              : install binaries into DIR instead of _vendor/bin
+   -proxy URL              : fetch the packages that are Go modules from the module proxy at
+                              URL (or $GOM_PROXY), and the others from their repositories
+   -retries N              : retry a failed fetch up to N times, waiting 1s, 2s, 4s and so on
+                              up to 30s in between; :retries overrides it for a package
+   -timeout DURATION       : kill VCS commands running longer than DURATION (default 10m,
+                              or $GOM_TIMEOUT); 0 disables the timeout
 `, os.Args[0])
 	os.Exit(1)
 }
@@ -41,33 +127,135 @@ var productionEnv = flag.Bool("production", false, "production environment")
 var developmentEnv = flag.Bool("development", false, "development environment")
 var testEnv = flag.Bool("test", false, "test environment")
 var verbose = flag.Bool("v", false, "enable verbosity")
-var customGroups = flag.String("groups", "", "comma-separated list of Gomfile groups")
+var quiet = flag.Bool("q", false, "print nothing but errors")
+var trace = flag.Bool("trace", false, "print how long every command took, and a summary of the install by package and phase")
+var customGroups = flag.String("groups", os.Getenv("GOM_GROUPS"), "comma-separated list of Gomfile groups")
+var withoutGroups = flag.String("without", os.Getenv("GOM_WITHOUT"), "comma-separated list of Gomfile groups to leave out")
 var gomFileName = flag.String("f", "Gomfile", "use file as Gomfile")
+var noCache = flag.Bool("no-cache", false, "do not use the download cache")
+var keepGoing = flag.Bool("keep-going", false, "keep installing after a package fails")
+var isolate = flag.Bool("isolate", false, "install with GOPATH set to the vendor directory only")
+var dryRun = flag.Bool("dry-run", false, "print the commands install would run without running them")
+var strict = flag.Bool("strict", false, "fail install when imports are missing from the vendor directory")
+var jsonOutput = flag.Bool("json", false, "print the results of install as JSON")
+var forceInstall = flag.Bool("force", false, "install every package again, even those unchanged since the last install")
+var frozen = flag.Bool("frozen", false, "fail install unless the vendor directory already matches the Gomfile")
+var recursiveGomfile = flag.Bool("recursive-gomfile", false, "install the packages listed by the Gomfiles of the packages too")
+var insecureFlag = flag.Bool("insecure", false, "let go get fetch every package over insecure schemes such as http, open to man-in-the-middle attacks")
+var updateAll = flag.Bool("update-all", false, "update the packages pinned to a branch or not pinned at all to their latest revision")
+var maxFetches = flag.Int("max-concurrent-fetches", 1, "fetch up to this many packages at once")
+var maxHostFetches = flag.Int("max-host-fetches", 4, "with -max-concurrent-fetches, fetch up to this many packages at once from the same host")
+var parallelBuild = flag.Bool("parallel-build", false, "build packages that don't import each other concurrently")
+var flatVendor = flag.Bool("flat-vendor", false, "keep the packages in ./vendor by their import paths, as go build finds them, between commands")
+var vendorExperiment = flag.String("vendor-experiment", "auto", "use the go1.5 vendor experiment layout: auto, on or off")
+var retries = flag.Int("retries", 0, "retry a failed fetch this many times")
+var manifestFile = flag.String("manifest", "", "write a JSON manifest of the installed packages to this file")
+var proxy = flag.String("proxy", os.Getenv("GOM_PROXY"), "fetch the packages that are Go modules from this module proxy")
+var offline = flag.Bool("offline", false, "build the vendored packages without fetching or checking out anything")
+var vendorFlag = flag.String("vendor", "", "use this directory as the vendor directory")
+var noColor = flag.Bool("no-color", false, "disable colored output")
+var gobinFlag = flag.String("gobin", "", "install binaries into this directory instead of the vendor directory")
+var timeout = flag.Duration("timeout", envDuration("GOM_TIMEOUT", 10*time.Minute), "kill VCS commands running longer than this")
+var onlyList stringList
 var customGroupList []string
+var withoutGroupList []string
 var vendorFolder string
 var go15VendorExperimentEnv bool
 
 func init() {
-	go15VendorExperimentEnv = len(os.Getenv("GO15VENDOREXPERIMENT")) > 0
+	flag.BoolVar(quiet, "quiet", false, "print nothing but errors")
+	flag.Var(&onlyList, "only", "install only this package; may be given more than once")
+	setVendorExperiment(len(os.Getenv("GO15VENDOREXPERIMENT")) > 0)
+}
+
+// setVendorExperiment sets whether the go1.5 vendor experiment layout is
+// used, together with the vendor directory that goes with it by default.
+func setVendorExperiment(on bool) {
+	go15VendorExperimentEnv = on
+	vendorFolder = envVendorFolder()
+}
+
+// envVendorFolder returns the vendor directory chosen by the environment.
+// GOM_VENDOR, a path, wins over GOM_VENDOR_NAME, a name in the project.
+func envVendorFolder() string {
+	if len(os.Getenv("GOM_VENDOR")) > 0 {
+		return os.Getenv("GOM_VENDOR")
+	}
 	if go15VendorExperimentEnv {
-		vendorFolder = "vendor"
-	} else {
-		if len(os.Getenv("GOM_VENDOR_NAME")) > 0 {
-			vendorFolder = os.Getenv("GOM_VENDOR_NAME")
-		} else {
-			vendorFolder = "_vendor"
+		return "vendor"
+	}
+	if len(os.Getenv("GOM_VENDOR_NAME")) > 0 {
+		return os.Getenv("GOM_VENDOR_NAME")
+	}
+	return "_vendor"
+}
+
+// envDuration returns the duration in the environment variable name, or
+// def when it isn't set or isn't a valid duration.
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return d
+	}
+	return def
+}
+
+// stringList is a flag that may be given more than once, collecting every
+// value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
 		}
 	}
+	return list
 }
 
 func vendorSrc(vendor string) string {
-	if go15VendorExperimentEnv {
-		return vendor
+	if flat := flatSrc(vendor); flat != "" && !movedToSrc {
+		return flat
 	} else {
 		return filepath.Join(vendor, "src")
 	}
 }
 
+// movedToSrc is set while the packages kept flat are moved into the src
+// directory of the vendor directory.
+var movedToSrc bool
+
+// flatVendorDir is the directory -flat-vendor keeps the packages in.
+const flatVendorDir = "vendor"
+
+// flatSrc returns the directory the packages are kept in by their import
+// paths between commands, which move them into the src directory of the
+// vendor directory for GOPATH: the vendor directory itself with the go1.5
+// vendor experiment layout, or vendor with -flat-vendor. It returns "" if
+// they stay in the src directory.
+func flatSrc(vendor string) string {
+	switch {
+	case go15VendorExperimentEnv:
+		return vendor
+	case *flatVendor:
+		if flat, err := filepath.Abs(flatVendorDir); err == nil {
+			return flat
+		}
+		return flatVendorDir
+	}
+	return ""
+}
+
 func main() {
 	flag.Usage = usage
 	flag.Parse()
@@ -80,38 +268,95 @@ func main() {
 		*developmentEnv = true
 	}
 
-	customGroupList = strings.Split(*customGroups, ",")
+	customGroupList = splitList(*customGroups)
+	withoutGroupList = splitList(*withoutGroups)
+	switch *vendorExperiment {
+	case "auto":
+		if *flatVendor {
+			// the vendor directory keeps the GOPATH layout
+			setVendorExperiment(false)
+		}
+	case "on", "off":
+		setVendorExperiment(*vendorExperiment == "on")
+	default:
+		fmt.Fprintln(os.Stderr, "gom: ", "-vendor-experiment must be auto, on or off")
+		os.Exit(1)
+	}
+	if *flatVendor && go15VendorExperimentEnv {
+		fmt.Fprintln(os.Stderr, "gom: ", "-flat-vendor can't be used with -vendor-experiment on, which keeps the packages flat in the vendor directory already")
+		os.Exit(1)
+	}
+	if *maxHostFetches < 1 {
+		fmt.Fprintln(os.Stderr, "gom: ", "-max-host-fetches must be at least 1")
+		os.Exit(1)
+	}
+	if *vendorFlag != "" {
+		vendorFolder = *vendorFlag
+	}
+	if vendor, err := filepath.Abs(vendorFolder); err == nil && *flatVendor && vendor == flatSrc(vendor) {
+		fmt.Fprintln(os.Stderr, "gom: ", "-flat-vendor needs a vendor directory other than "+flatVendorDir)
+		os.Exit(1)
+	}
 
 	var err error
 	subArgs := flag.Args()[1:]
 	switch flag.Arg(0) {
 	case "install", "i":
 		err = install(subArgs)
+	case "update", "u":
+		err = quietly(func() error { return update(subArgs) })
 	case "build", "b":
-		err = run(append([]string{"go", "build"}, subArgs...), None)
+		err = quietly(func() error { return run(append([]string{"go", "build"}, subArgs...), None) })
 	case "test", "t":
-		err = run(append([]string{"go", "test"}, subArgs...), None)
+		err = quietly(func() error { return testVendor(subArgs) })
 	case "run", "r":
-		err = run(append([]string{"go", "run"}, subArgs...), None)
+		err = runVendor(subArgs)
 	case "doc", "d":
-		err = run(append([]string{"godoc"}, subArgs...), None)
+		err = doc(subArgs)
 	case "exec", "e":
-		err = run(subArgs, None)
-	case "env", "tool", "fmt", "list", "vet":
+		err = quietly(func() error { return execVendor(subArgs) })
+	case "env":
+		err = env(subArgs)
+	case "tool", "fmt", "list", "vet":
 		err = run(append([]string{"go", flag.Arg(0)}, subArgs...), None)
 	case "gen", "g":
 		switch flag.Arg(1) {
 		case "travis-yml":
 			err = genTravisYml()
+		case "github-actions":
+			err = genGithubActions(flag.Args()[2:])
 		case "gomfile":
-			err = genGomfile()
+			err = genGomfile(flag.Args()[2:])
 		default:
 			usage()
 		}
 	case "lock", "l":
-		err = genGomfileLock()
+		err = quietly(func() error { return genGomfileLock(subArgs) })
+	case "freeze":
+		err = freeze(subArgs)
+	case "check":
+		err = quietly(check)
+	case "verify":
+		err = verify()
+	case "tree":
+		err = tree()
+	case "status":
+		err = status()
+	case "which":
+		err = which(subArgs)
+	case "info":
+		err = info(subArgs)
+	case "outdated":
+		err = outdated()
+	case "prune":
+		err = quietly(func() error { return prune(subArgs) })
+	case "clean":
+		err = quietly(func() error { return clean(subArgs) })
 	case "populate":
-		_, err = populate(subArgs)
+		err = quietly(func() error {
+			_, err := populate(subArgs)
+			return err
+		})
 	default:
 		usage()
 	}
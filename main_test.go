@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnvVendorFolder(t *testing.T) {
+	for _, name := range []string{"GOM_VENDOR", "GOM_VENDOR_NAME"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	defer func(v bool) { go15VendorExperimentEnv = v }(go15VendorExperimentEnv)
+
+	tests := []struct {
+		vendor     string
+		vendorName string
+		go15       bool
+		expected   string
+	}{
+		{"", "", false, "_vendor"},
+		{"", "deps", false, "deps"},
+		{"", "deps", true, "vendor"},
+		{"/shared/gom", "deps", false, "/shared/gom"},
+		{"/shared/gom", "", true, "/shared/gom"},
+	}
+	for _, test := range tests {
+		os.Setenv("GOM_VENDOR", test.vendor)
+		os.Setenv("GOM_VENDOR_NAME", test.vendorName)
+		go15VendorExperimentEnv = test.go15
+		if got := envVendorFolder(); got != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, got)
+		}
+	}
+}
+
+func TestSetVendorExperiment(t *testing.T) {
+	for _, name := range []string{"GOM_VENDOR", "GOM_VENDOR_NAME"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, "")
+	}
+	defer func(v bool) { go15VendorExperimentEnv = v }(go15VendorExperimentEnv)
+	defer func(folder string) { vendorFolder = folder }(vendorFolder)
+
+	tests := []struct {
+		on       bool
+		expected string
+	}{
+		{true, "vendor"},
+		{false, "_vendor"},
+	}
+	for _, test := range tests {
+		setVendorExperiment(test.on)
+		if go15VendorExperimentEnv != test.on || vendorFolder != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, vendorFolder)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// missingImports lists the imports of the packages below the current
+// directory that can't be satisfied from the vendor directory alone. Those
+// are either missing from the Gomfile or were added by a checked out
+// commit, and would otherwise silently come from the outer GOPATH.
+func missingImports(vendor string) ([]string, error) {
+	// Imports of the project's own packages don't need to be vendored.
+	own, err := ownImportPath()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := goList([]string{"GOPATH=" + vendor},
+		"-e", "-deps", "-f", "{{if not .Dir}}{{.ImportPath}}{{end}}", "./...")
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, path := range strings.Fields(out) {
+		if isOwnPackage(own, path) {
+			continue
+		}
+		missing = appendPkg(missing, path)
+	}
+	return missing, nil
+}
+
+// ownImportPath returns the import path of the package in the current
+// directory.
+func ownImportPath() (string, error) {
+	out, err := goList(nil, "-e", "-f", "{{.ImportPath}}", ".")
+	return strings.TrimSpace(out), err
+}
+
+// isOwnPackage reports whether path is one of the project's own packages,
+// given the import path own of the project. Packages outside any GOPATH
+// get a "_/" import path.
+func isOwnPackage(own, path string) bool {
+	return strings.HasPrefix(path, "_/") || path == own || strings.HasPrefix(path, own+"/")
+}
+
+func goList(env []string, args ...string) (string, error) {
+	args = append([]string{"go", "list"}, args...)
+	if *verbose {
+		fmt.Printf("%s%q\n", strings.Join(append(env, ""), " "), args)
+	}
+	var buf bytes.Buffer
+	cmd, done := command(args)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &buf
+	cmd.Stderr = os.Stderr
+	err := done(cmd.Run())
+	return buf.String(), err
+}
+
+// checkMissing reports the imports missing from the vendor directory, as
+// warnings or, with -strict, as an error.
+func checkMissing() error {
+	if go15VendorExperimentEnv || *dryRun {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	missing, err := missingImports(vendor)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	for _, path := range missing {
+		fmt.Fprintf(os.Stderr, "Warning: %s is imported but not in %s\n", path, vendorFolder)
+	}
+	if *strict {
+		return fmt.Errorf("%d imports are missing from %s; add them to %s", len(missing), vendorFolder, *gomFileName)
+	}
+	return nil
+}
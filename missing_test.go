@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMissingImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor := filepath.Join(dir, "_vendor")
+	files := map[string]string{
+		filepath.Join(dir, "main.go"): `package main
+import (
+	_ "example.com/absent"
+	_ "example.com/vendored"
+)
+func main() {}`,
+		filepath.Join(vendor, "src", "example.com", "vendored", "v.go"): `package vendored`,
+	}
+	for p, src := range files {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(src+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	missing, err := missingImports(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com/absent"}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, missing)
+	}
+
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = "_vendor"
+	defer func(v bool) { *strict = v }(*strict)
+	*strict = false
+	if err := checkMissing(); err != nil {
+		t.Fatalf("Expected %v, but %v:", nil, err)
+	}
+	*strict = true
+	if err := checkMissing(); err == nil {
+		t.Fatalf("Expected %v, but %v:", "an error", err)
+	}
+}
+
+func TestIsOwnPackage(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"example.com/proj", true},
+		{"example.com/proj/sub", true},
+		{"example.com/project", false},
+		{"_/home/user/proj", true},
+		{"example.com/dep", false},
+	}
+	for _, test := range tests {
+		if got := isOwnPackage("example.com/proj", test.path); got != test.expected {
+			t.Fatalf("Expected %v, but %v: %s", test.expected, got, test.path)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moduleStamp is the file recording the version of a module in the
+// directory it is vendored in.
+const moduleStamp = ".gom-module"
+
+// vcsOptions lists the options that need the repository of a gom, so that
+// -proxy leaves the goms with one of them to their VCS.
+var vcsOptions = []string{
+	"bookmark", "command", "date", "depth", "insecure", "lfs", "mirror", "private", "recursive",
+	"remote", "repo_root", "scheme", "shallow", "since", "ssh_host", "token_env",
+}
+
+// module reports whether gom is a Go module fetched with go mod download
+// instead of go get: if its module option says so, or else with -proxy
+// unless it needs its repository.
+func (gom *Gom) module() bool {
+	if module, ok := gom.options["module"].(string); ok {
+		return module == "true"
+	}
+	if *proxy == "" {
+		return false
+	}
+	for _, key := range vcsOptions {
+		if has(gom.options, key) {
+			return false
+		}
+	}
+	tag, _ := gom.options["tag"].(string)
+	return !isTagPattern(tag)
+}
+
+// fetchModule is downloadModule, except that a gom which is only a module
+// because of -proxy is fetched from its repository instead when the proxy
+// doesn't have it. It reports whether gom was downloaded as a module.
+func (gom *Gom) fetchModule(vendor string) (bool, error) {
+	err := gom.downloadModule(vendor)
+	if err == nil || has(gom.options, "module") || rootCtx.Err() != nil {
+		return true, err
+	}
+	fmt.Printf("Warning: %v; fetching %s from its repository\n", err, gom.name)
+	gom.options["module"] = "false"
+	return false, nil
+}
+
+// moduleVersion returns the version gom is fetched at: its pin, or the
+// latest version when it isn't pinned.
+func (gom *Gom) moduleVersion() string {
+	if _, ref := gom.pin(); ref != "" {
+		return ref
+	}
+	return "latest"
+}
+
+// downloadModule downloads gom at its version into the module cache with
+// go mod download, and copies it from there into the vendor source
+// directory in place of what was there.
+func (gom *Gom) downloadModule(vendor string) error {
+	query := gom.name + "@" + gom.moduleVersion()
+	fmt.Printf("%sdownloading module %s\n", gom.progress(), query)
+	args := []string{"go", "mod", "download", "-json", query}
+	env := []string{"GO111MODULE=on", "GOFLAGS=-mod=mod"}
+	if *proxy != "" {
+		env = append(env, "GOPROXY="+*proxy)
+	}
+	env = append(env, gom.fetchEnv()...)
+	if *verbose || *dryRun {
+		fmt.Println(redact(fmt.Sprintf("%s%q", strings.Join(append(env, ""), " "), args)))
+	}
+	if *dryRun {
+		return nil
+	}
+
+	cmd, done := command(args)
+	// outside of any module, whose go.mod would otherwise be used
+	cmd.Dir = os.TempDir()
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = stderr
+	b, err := cmd.Output()
+	var mod struct {
+		Version string
+		Dir     string
+		Error   string
+	}
+	if jerr := json.Unmarshal(b, &mod); jerr == nil && mod.Error != "" {
+		return fmt.Errorf("can't download module %s: %s", query, mod.Error)
+	}
+	if err = done(err); err != nil {
+		return err
+	}
+	if mod.Dir == "" {
+		return fmt.Errorf("can't download module %s: go mod download printed no directory", query)
+	}
+
+	dest := filepath.Join(vendorSrc(vendor), filepath.FromSlash(gom.Target()))
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := copyTree(mod.Dir, dest); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, moduleStamp), []byte(mod.Version+"\n"), 0644)
+}
+
+// vendoredModuleVersion returns the version of the module vendored in dir,
+// or "" if there isn't one.
+func vendoredModuleVersion(dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, moduleStamp))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// moduleAt reports whether a module at version is at the pin of kind ref.
+// A commit is the last part of a pseudo-version, and a branch can't be told
+// without asking the proxy, so any version is at it.
+func moduleAt(version, kind, ref string) bool {
+	switch {
+	case version == ref:
+		return true
+	case kind == "commit" && strings.Count(version, "-") >= 2:
+		return sameRevision(version[strings.LastIndex(version, "-")+1:], ref)
+	}
+	return kind == "branch" || kind == "bookmark"
+}
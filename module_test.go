@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestModuleAt(t *testing.T) {
+	for _, tt := range []struct {
+		version  string
+		kind     string
+		ref      string
+		expected bool
+	}{
+		{"v1.2.3", "tag", "v1.2.3", true},
+		{"v1.2.3", "tag", "v1.2.4", false},
+		{"v1.2.3", "commit", "v1.2.3", true},
+		{"v0.0.0-20200102030405-0123456789ab", "commit", "0123456789abcdef0123456789abcdef01234567", true},
+		{"v0.0.0-20200102030405-0123456789ab", "commit", "fedcba9876543210fedcba9876543210fedcba98", false},
+		{"v1.2.4-0.20200102030405-0123456789ab", "commit", "0123456", true},
+		{"v1.2.3-rc1", "commit", "rc1", false},
+		{"v1.2.3", "branch", "master", true},
+	} {
+		if at := moduleAt(tt.version, tt.kind, tt.ref); at != tt.expected {
+			t.Fatalf("Expected %v, but %v:", tt.expected, at)
+		}
+	}
+}
+
+func TestModuleProxy(t *testing.T) {
+	defer func(p string) { *proxy = p }(*proxy)
+	for _, tt := range []struct {
+		proxy    string
+		options  map[string]interface{}
+		expected bool
+	}{
+		{"", map[string]interface{}{"tag": "v1.2.3"}, false},
+		{"", map[string]interface{}{"module": "true"}, true},
+		{"https://proxy.example.com", map[string]interface{}{"tag": "v1.2.3"}, true},
+		{"https://proxy.example.com", map[string]interface{}{"module": "false"}, false},
+		{"https://proxy.example.com", map[string]interface{}{"private": "true"}, false},
+		{"https://proxy.example.com", map[string]interface{}{"tag": "v1.*"}, false},
+	} {
+		*proxy = tt.proxy
+		gom := Gom{name: "github.com/mattn/go-runewidth", options: tt.options}
+		if module := gom.module(); module != tt.expected {
+			t.Fatalf("Expected %v, but %v:", tt.expected, module)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// remoteRefs maps the refs of a remote repository, as listed by
+// git ls-remote, to the commits they point to. Annotated tags point to the
+// commit they tag.
+type remoteRefs map[string]string
+
+func lsRemote(dir string) (remoteRefs, error) {
+	out, err := vcsOutput(dir, "git", "ls-remote", "origin")
+	if err != nil {
+		return nil, err
+	}
+	refs := make(remoteRefs)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ref := fields[1]
+		if strings.HasSuffix(ref, "^{}") {
+			refs[strings.TrimSuffix(ref, "^{}")] = fields[0]
+		} else if _, ok := refs[ref]; !ok {
+			refs[ref] = fields[0]
+		}
+	}
+	return refs, nil
+}
+
+// tags returns the tag names in refs.
+func (refs remoteRefs) tags() []string {
+	var tags []string
+	for ref := range refs {
+		if strings.HasPrefix(ref, "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	return tags
+}
+
+// parseVersion splits a tag such as v1.2.3-rc.1 into its numbers and its
+// pre-release suffix. ok is false when tag isn't a version.
+func parseVersion(tag string) (nums []int, pre string, ok bool) {
+	v := strings.TrimPrefix(tag, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v, pre = v[:i], v[i:]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return nil, "", false
+	}
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+		nums = append(nums, n)
+	}
+	return nums, pre, true
+}
+
+// newerVersion reports whether version tag a is newer than b. A release is
+// newer than its pre-releases.
+func newerVersion(a, b string) bool {
+	an, apre, _ := parseVersion(a)
+	bn, bpre, _ := parseVersion(b)
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(an) {
+			x = an[i]
+		}
+		if i < len(bn) {
+			y = bn[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	if apre == "" || bpre == "" {
+		return apre == "" && bpre != ""
+	}
+	return apre > bpre
+}
+
+// isTagPattern reports whether tag is a pattern, such as v1.*, matching
+// the tag to check out rather than being one.
+func isTagPattern(tag string) bool {
+	return strings.ContainsAny(tag, "*?[")
+}
+
+// matchingTag returns the newest of tags that matches pattern, with
+// the pattern syntax of path.Match.
+func matchingTag(tags []string, pattern string) (string, error) {
+	var matches []string
+	for _, tag := range tags {
+		ok, err := path.Match(pattern, tag)
+		if err != nil {
+			return "", fmt.Errorf("invalid tag pattern %s: %v", pattern, err)
+		}
+		if ok {
+			matches = append(matches, tag)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no tag matches %s", pattern)
+	}
+	return latestTag(matches), nil
+}
+
+// latestTag returns the newest of tags. Tags that are versions are sorted
+// as such, and pre-releases only count when there is no release. When no
+// tag is a version, the last tag by name is returned.
+func latestTag(tags []string) string {
+	release, pre, name := "", "", ""
+	for _, tag := range tags {
+		_, suffix, ok := parseVersion(tag)
+		switch {
+		case !ok:
+			if tag > name {
+				name = tag
+			}
+		case suffix == "":
+			if release == "" || newerVersion(tag, release) {
+				release = tag
+			}
+		default:
+			if pre == "" || newerVersion(tag, pre) {
+				pre = tag
+			}
+		}
+	}
+	switch {
+	case release != "":
+		return release
+	case pre != "":
+		return pre
+	}
+	return name
+}
+
+// outdated lists, for every installed git gom that is pinned, the newest
+// tag upstream and whether the tip of its branch moved past the pin. It
+// only reads from the remotes.
+func outdated() error {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tPIN\tLATEST TAG\tBRANCH TIP")
+	for _, gom := range filterGoms(allGoms) {
+		kind, ref := gom.pin()
+		if kind == "" {
+			continue
+		}
+		pin := kind + " " + ref
+		p, vcs := gom.findVCS(vendorSrc(vendor))
+		switch {
+		case vcs == nil:
+			fmt.Fprintf(w, "%s\t%s\tnot installed\t\n", gom.name, pin)
+			continue
+		case vcs != git:
+			fmt.Fprintf(w, "%s\t%s\tnot supported\t\n", gom.name, pin)
+			continue
+		}
+		refs, err := lsRemote(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", gom.name, err)
+		}
+
+		latest := latestTag(refs.tags())
+		if latest == "" {
+			latest = "-"
+		} else if kind == "tag" && latest == ref {
+			latest += " (pinned)"
+		}
+
+		var pinned, tip string
+		switch kind {
+		case "commit":
+			pinned, tip = ref, refs["HEAD"]
+		case "tag":
+			pinned, tip = refs["refs/tags/"+ref], refs["HEAD"]
+		case "branch":
+			pinned, _ = vcs.Revision(p)
+			tip = refs["refs/heads/"+ref]
+		}
+		moved := "-"
+		switch {
+		case tip == "" || pinned == "":
+		case sameRevision(pinned, tip):
+			moved = "up to date"
+		default:
+			moved = "moved to " + tip[:7]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", gom.name, pin, latest, moved)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLatestTag(t *testing.T) {
+	tests := []struct {
+		tags     []string
+		expected string
+	}{
+		{[]string{"v1.2.0", "v1.10.0", "v1.9.3"}, "v1.10.0"},
+		{[]string{"v1.2.0", "v2.0.0-rc1"}, "v1.2.0"},
+		{[]string{"v2.0.0-rc1", "v2.0.0-beta"}, "v2.0.0-rc1"},
+		{[]string{"1.0", "1.0.1", "release-x"}, "1.0.1"},
+		{[]string{"go1", "weekly"}, "weekly"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if latest := latestTag(test.tags); latest != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, latest)
+		}
+	}
+}
+
+func TestMatchingTag(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.10.0", "v1.2.3", "v1.11.0-rc1", "v2.0.0", "release-1"}
+	for _, tt := range []struct {
+		pattern  string
+		expected string
+	}{
+		{"v1.*", "v1.10.0"},
+		{"v1.2.*", "v1.2.3"},
+		{"v*", "v2.0.0"},
+		{"release-?", "release-1"},
+	} {
+		tag, err := matchingTag(tags, tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag != tt.expected {
+			t.Fatalf("Expected %v, but %v:", tt.expected, tag)
+		}
+	}
+	if _, err := matchingTag(tags, "v3.*"); err == nil {
+		t.Fatalf("Expected an error for %v, but none", "v3.*")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// outputMu serializes the writes of all prefixWriters, so that lines from
+// different goms never interleave.
+var outputMu sync.Mutex
+
+// prefixWriter writes whole lines to w, each tagged with a prefix such as
+// the name of the gom whose commands print them. A partial line is held
+// back until the rest of it is written, or until Flush.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes what is left of a partial line.
+func (pw *prefixWriter) Flush() error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	err := pw.writeLine(append(pw.buf, '\n'))
+	pw.buf = nil
+	return err
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	_, err := pw.w.Write(append([]byte(pw.prefix), line...))
+	return err
+}
+
+// prefixOutput tags the lines the commands run for gom print with its
+// name, until the returned function is called.
+func (gom *Gom) prefixOutput() func() {
+	out, errOut := stdout, stderr
+	pout := newPrefixWriter(out, gom.name+": ")
+	perr := newPrefixWriter(errOut, gom.name+": ")
+	stdout, stderr = pout, perr
+	return func() {
+		pout.Flush()
+		perr.Flush()
+		stdout, stderr = out, errOut
+	}
+}
+
+// quietly runs f with -q in effect: the lines gom prints itself are
+// dropped, and what the commands it runs print on stdout is held back, to
+// be shown on stderr only if f fails. Their stderr is shown as usual.
+func quietly(f func() error) error {
+	if !*quiet {
+		return f()
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+	held := &syncBuffer{}
+	osOut, out := os.Stdout, stdout
+	os.Stdout, stdout = null, held
+	err = f()
+	os.Stdout, stdout = osOut, out
+	if err != nil {
+		stderr.Write(held.Bytes())
+	}
+	return err
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	a := newPrefixWriter(&buf, "a: ")
+	b := newPrefixWriter(&buf, "b: ")
+	a.Write([]byte("Cloning "))
+	b.Write([]byte("one\ntwo\nthr"))
+	a.Write([]byte("into x...\n"))
+	a.Flush()
+	b.Flush()
+	expected := "b: one\nb: two\na: Cloning into x...\nb: thr\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, but %q:", expected, buf.String())
+	}
+}
+
+func TestQuietly(t *testing.T) {
+	defer func(q bool, out, errOut io.Writer) {
+		*quiet, stdout, stderr = q, out, errOut
+	}(*quiet, stdout, stderr)
+	*quiet = true
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{errors.New("exit status 1"), "--- FAIL: TestX\n"},
+	}
+	for _, test := range tests {
+		errOut.Reset()
+		err := quietly(func() error {
+			fmt.Println("building example.com/a")
+			fmt.Fprint(stdout, "--- FAIL: TestX\n")
+			return test.err
+		})
+		if err != test.err {
+			t.Fatalf("Expected %v, but %v:", test.err, err)
+		}
+		if errOut.String() != test.expected {
+			t.Fatalf("Expected %q, but %q:", test.expected, errOut.String())
+		}
+		if out.Len() != 0 {
+			t.Fatalf("Expected no output, but %q:", out.String())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prune removes the repositories in the vendor directory that neither a
+// Gomfile entry, of any group, nor anything they or the project import
+// needs any more. Repositories are removed whole, so one that holds a
+// package still in use stays with all of its packages.
+func prune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	force := fs.Bool("f", false, "don't ask for confirmation")
+	fs.BoolVar(dryRun, "dry-run", *dryRun, "only print what would be removed")
+	fs.Parse(args)
+
+	allGroups = true
+	allGoms, err := parseGomfile(*gomFileName)
+	allGroups = false
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	src := vendorSrc(vendor)
+	if !isDir(src) {
+		return nil
+	}
+	err = checkCleanable(vendor)
+	if err != nil {
+		return err
+	}
+	allGoms, err = expandGlobs(allGoms, vendoredRepositories(vendor))
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	repos, err := vendoredRepos(src, vendor)
+	if err != nil {
+		return err
+	}
+	used, err := usedRepos(src, repos, allGoms, cwd)
+	if err != nil {
+		return err
+	}
+	var unused []string
+	for _, repo := range repos {
+		if !used[repo] {
+			unused = append(unused, repo)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+
+	if *dryRun {
+		for _, repo := range unused {
+			fmt.Printf("would remove %s\n", repo)
+		}
+		return nil
+	}
+	if !*force {
+		fmt.Printf("Remove %s? [y/N] ", strings.Join(unused, ", "))
+		answer, _ := bufio.NewReader(stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+	for _, repo := range unused {
+		fmt.Printf("removing %s\n", repo)
+		dir := filepath.Join(src, filepath.FromSlash(repo))
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		// and the directories of its host and owner, once they are empty
+		for dir = filepath.Dir(dir); dir != src; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// vendoredRepos returns the import paths of the repositories in the vendor
+// source directory src: the checkouts, and the modules gom downloaded.
+func vendoredRepos(src, vendor string) ([]string, error) {
+	var repos []string
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() || p == src {
+			return nil
+		}
+		if src == vendor && filepath.Dir(p) == src && (fi.Name() == "bin" || fi.Name() == "pkg") {
+			// the vendor directory is the source directory too
+			return filepath.SkipDir
+		}
+		if vcsForDir(p) != nil || isFile(filepath.Join(p, moduleStamp)) {
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(repos)
+	return repos, err
+}
+
+// usedRepos returns which of repos hold a gom, or a package that the
+// project in cwd or a package of another used repository imports. Imports
+// are read from every Go file, whatever its build constraints, so that
+// what only some platforms or the tests need is kept as well.
+func usedRepos(src string, repos []string, goms []Gom, cwd string) (map[string]bool, error) {
+	repoOf := func(importPath string) string {
+		found := ""
+		for _, repo := range repos {
+			if (importPath == repo || strings.HasPrefix(importPath, repo+"/")) && len(repo) > len(found) {
+				found = repo
+			}
+		}
+		return found
+	}
+
+	used := make(map[string]bool)
+	var queue []string
+	use := func(importPath string) {
+		if repo := repoOf(importPath); repo != "" && !used[repo] {
+			used[repo] = true
+			queue = append(queue, repo)
+		}
+	}
+	for _, gom := range goms {
+		use(gom.Target())
+		// a gom holding several repositories, as a :command may fetch
+		for _, repo := range repos {
+			if strings.HasPrefix(repo, gom.Target()+"/") {
+				use(repo)
+			}
+		}
+	}
+	imports, err := importsBelow(cwd, src)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range imports {
+		use(imp)
+	}
+	for len(queue) > 0 {
+		repo := queue[0]
+		queue = queue[1:]
+		imports, err := importsBelow(filepath.Join(src, filepath.FromSlash(repo)), "")
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range imports {
+			use(imp)
+		}
+	}
+	return used, nil
+}
+
+// importsBelow returns the imports of the Go files in dir and below it,
+// leaving out skip, testdata and the directories go ignores.
+func importsBelow(dir, skip string) ([]string, error) {
+	var imports []string
+	fset := token.NewFileSet()
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := fi.Name()
+		if fi.IsDir() {
+			if p != dir && (p == skip || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			// a broken file imports nothing we could tell
+			return nil
+		}
+		for _, spec := range f.Imports {
+			if imp, err := strconv.Unquote(spec.Path.Value); err == nil && !isStandardImport(imp) {
+				imports = append(imports, imp)
+			}
+		}
+		return nil
+	})
+	return imports, err
+}
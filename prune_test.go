@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUsedRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "_vendor", "src")
+	files := map[string]string{
+		"main.go":                              "package main\nimport _ \"example.com/own/dep\"\n",
+		"_vendor/src/example.com/a/a.go":       "package a\nimport \"example.com/b/sub\"\n",
+		"_vendor/src/example.com/b/sub/b.go":   "package sub\nimport \"fmt\"\n",
+		"_vendor/src/example.com/c/c.go":       "package c\n",
+		"_vendor/src/example.com/d/x/x.go":     "package x\n",
+		"_vendor/src/example.com/own/dep/d.go": "// +build windows\n\npackage dep\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, repo := range []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d", "example.com/own/dep"} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.FromSlash(repo), ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := vendoredRepos(src, filepath.Join(dir, "_vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d", "example.com/own/dep"}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, repos)
+	}
+	goms := []Gom{
+		{name: "example.com/a", options: map[string]interface{}{}},
+		{name: "example.com/d/x", options: map[string]interface{}{}},
+	}
+	used, err := usedRepos(src, repos, goms, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedUsed := map[string]bool{"example.com/a": true, "example.com/b": true, "example.com/d": true, "example.com/own/dep": true}
+	if !reflect.DeepEqual(used, expectedUsed) {
+		t.Fatalf("Expected %v, but %v:", expectedUsed, used)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// installResult is what -json reports about the install of one gom.
+type installResult struct {
+	ImportPath string  `json:"import_path,omitempty"`
+	Revision   string  `json:"revision,omitempty"`
+	Fetch      string  `json:"fetch,omitempty"` // cloned, cached, existing or unchanged
+	Built      bool    `json:"built"`
+	Error      string  `json:"error,omitempty"`
+	Duration   float64 `json:"duration_seconds"`
+
+	// phases holds the time each phase took, clone, checkout and build,
+	// for -trace.
+	phases map[string]time.Duration
+}
+
+// since adds the time since start to the duration of r, and to that of
+// its phase.
+func (r *installResult) since(phase string, start time.Time) {
+	d := time.Since(start)
+	r.Duration += d.Seconds()
+	if r.phases == nil {
+		r.phases = make(map[string]time.Duration)
+	}
+	r.phases[phase] += d
+}
+
+// installResults collects the results of an install in Gomfile order.
+type installResults struct {
+	byName map[string]*installResult
+	list   []*installResult
+}
+
+var results = &installResults{byName: make(map[string]*installResult)}
+
+// get returns the result of the gom called name.
+func (rs *installResults) get(name string) *installResult {
+	r, ok := rs.byName[name]
+	if !ok {
+		r = &installResult{ImportPath: name}
+		rs.byName[name] = r
+		rs.list = append(rs.list, r)
+	}
+	return r
+}
+
+// write prints the results as a JSON array. An error that no gom reported,
+// such as a broken Gomfile, gets an object of its own.
+func (rs *installResults) write(w io.Writer, err error) error {
+	list := rs.list
+	if _, ok := err.(gomErrors); err != nil && !ok {
+		reported := false
+		for _, r := range list {
+			reported = reported || r.Error == err.Error()
+		}
+		if !reported {
+			list = append(list, &installResult{Error: err.Error()})
+		}
+	}
+	if list == nil {
+		list = []*installResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if jerr := enc.Encode(list); jerr != nil {
+		return jerr
+	}
+	return err
+}
+
+// revision returns the revision gom is checked out at, or "" when it
+// can't tell.
+func (gom *Gom) revision(vendor string) string {
+	p, vcs := gom.findVCS(filepath.Join(vendor, "src"))
+	if vcs == nil {
+		return ""
+	}
+	rev, _ := vcs.Revision(p)
+	return rev
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallResultsWrite(t *testing.T) {
+	tests := []struct {
+		names    []string
+		failed   string // the gom that fails, if any
+		err      error
+		expected []string // the import paths written, "" for the error
+	}{
+		{nil, "", nil, []string{}},
+		{[]string{"example.com/a", "example.com/b"}, "", nil, []string{"example.com/a", "example.com/b"}},
+		{[]string{"example.com/a"}, "", errors.New("Gomfile: syntax error"), []string{"example.com/a", ""}},
+		{[]string{"example.com/a"}, "example.com/a", errors.New("clone failed"), []string{"example.com/a"}},
+		{[]string{"example.com/a"}, "example.com/a", gomErrors{{"example.com/a", errors.New("clone failed")}}, []string{"example.com/a"}},
+	}
+	for _, test := range tests {
+		rs := &installResults{byName: make(map[string]*installResult)}
+		for _, name := range test.names {
+			rs.get(name).Built = true
+		}
+		if test.failed != "" {
+			rs.get(test.failed).Error = "clone failed"
+		}
+		var buf bytes.Buffer
+		if err := rs.write(&buf, test.err); (err == nil) != (test.err == nil) {
+			t.Fatalf("Expected %v, but %v:", test.err, err)
+		}
+		var list []installResult
+		if err := json.Unmarshal(buf.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, r := range list {
+			paths = append(paths, r.ImportPath)
+		}
+		if len(paths) != len(test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, paths)
+		}
+		for i := range paths {
+			if paths[i] != test.expected[i] {
+				t.Fatalf("Expected %v, but %v:", test.expected, paths)
+			}
+		}
+	}
+}
+
+func TestGomRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor := filepath.Join(dir, "_vendor")
+	repo := filepath.Join(vendor, "src", "example.com", "repo")
+	gitRepo(t, repo, map[string]string{"a.go": "package a\n"})
+	expected := gitOutput(t, repo, "rev-parse", "HEAD")
+
+	gom := Gom{name: "example.com/repo", options: map[string]interface{}{}}
+	if rev := gom.revision(vendor); rev != expected {
+		t.Fatalf("Expected %v, but %v:", expected, rev)
+	}
+	gom = Gom{name: "example.com/missing", options: map[string]interface{}{}}
+	if rev := gom.revision(vendor); rev != "" {
+		t.Fatalf("Expected %v, but %v:", "", rev)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// installStateFile is the file in the vendor directory that records what
+// the last install left every gom at.
+const installStateFile = ".gom-installed"
+
+// installedGom is what the state file records about a gom: its Gomfile
+// entry together with the arguments it was built with, and the revision
+// it was checked out at.
+type installedGom struct {
+	Pin      string `json:"pin"`
+	Revision string `json:"revision"`
+}
+
+// installState maps the names of the goms to what the last install left
+// them at.
+type installState map[string]installedGom
+
+// readInstallState reads the state file of vendor. A missing or broken
+// state file is an empty state, so that everything is installed again.
+func readInstallState(vendor string) installState {
+	state := make(installState)
+	b, err := ioutil.ReadFile(filepath.Join(vendor, installStateFile))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring %s: %v\n", installStateFile, err)
+		return make(installState)
+	}
+	return state
+}
+
+// write replaces the state file of vendor with state.
+func (state installState) write(vendor string) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(vendor, installStateFile), append(b, '\n'), 0644)
+}
+
+// installPin returns what the state file compares to tell whether the
+// Gomfile entry of gom, or the arguments it is built with, changed.
+func (gom *Gom) installPin(args []string) string {
+	// encoding/json sorts the keys of maps
+	b, _ := json.Marshal(gom.options)
+	if len(args) == 0 {
+		return string(b)
+	}
+	return string(b) + " " + strings.Join(args, " ")
+}
+
+// markUnchanged marks the goms which the last install left as they would
+// be installed now, so that install skips them: the same Gomfile entry and
+// arguments, and their checkout still at the revision it was left at. Goms
+// that float, or that -update-all moves, are installed every time, and so
+// is everything with -force.
+func markUnchanged(vendor string, goms []Gom, args []string) {
+	if *forceInstall {
+		return
+	}
+	state := readInstallState(vendor)
+	for i := range goms {
+		gom := &goms[i]
+		installed, ok := state[gom.name]
+		if !ok || gom.floating() || installed.Pin != gom.installPin(args) {
+			continue
+		}
+		if rev := gom.revision(vendor); rev == "" || rev != installed.Revision {
+			continue
+		}
+		gom.unchanged = true
+		fmt.Printf("%s%s is unchanged since the last install\n", gom.progress(), gom.name)
+	}
+}
+
+// saveInstallState records the goms that were installed, and forgets those
+// that failed, keeping what the state file of vendor says about the goms
+// this install left alone.
+func saveInstallState(vendor string, goms []Gom, failed gomErrors, args []string) error {
+	if *dryRun {
+		return nil
+	}
+	state := readInstallState(vendor)
+	for _, gom := range goms {
+		state[gom.name] = installedGom{Pin: gom.installPin(args), Revision: gom.revision(vendor)}
+	}
+	for _, f := range failed {
+		delete(state, f.name)
+	}
+	return state.write(vendor)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInstallPin(t *testing.T) {
+	gom := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1", "goos": "linux"}}
+	same := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"goos": "linux", "tag": "v1"}}
+	moved := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"goos": "linux", "tag": "v2"}}
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{gom.installPin(nil), same.installPin(nil), true},
+		{gom.installPin([]string{"-tags", "a"}), same.installPin([]string{"-tags", "a"}), true},
+		{gom.installPin(nil), moved.installPin(nil), false},
+		{gom.installPin(nil), gom.installPin([]string{"-tags", "a"}), false},
+	}
+	for _, test := range tests {
+		if same := test.a == test.b; same != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, same)
+		}
+	}
+}
+
+func TestSaveInstallState(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	if state := readInstallState(vendor); len(state) != 0 {
+		t.Fatalf("Expected %v, but %v:", installState{}, state)
+	}
+	err = installState{
+		"example.com/kept":   {Pin: "{}", Revision: "abc"},
+		"example.com/failed": {Pin: "{}", Revision: "def"},
+	}.write(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms := []Gom{
+		{name: "example.com/new", options: map[string]interface{}{"commit": "123"}},
+		{name: "example.com/failed", options: map[string]interface{}{}},
+	}
+	failed := gomErrors{{"example.com/failed", errors.New("exit status 1")}}
+	err = saveInstallState(vendor, goms, failed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := installState{
+		"example.com/kept": {Pin: "{}", Revision: "abc"},
+		"example.com/new":  {Pin: `{"commit":"123"}`},
+	}
+	if state := readInstallState(vendor); !reflect.DeepEqual(state, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, state)
+	}
+
+	// a broken state file installs everything again
+	err = ioutil.WriteFile(filepath.Join(vendor, installStateFile), []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := readInstallState(vendor); len(state) != 0 {
+		t.Fatalf("Expected %v, but %v:", installState{}, state)
+	}
+}
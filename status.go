@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// status prints the revision every gom is at, whether its checkout has
+// uncommitted changes, and whether it is at its pin. Nothing is changed.
+func status() error {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tREVISION\tCHANGES\tPIN")
+	for _, gom := range filterGoms(allGoms) {
+		rev, changes, err := gom.vendoredState(vendor)
+		if err != nil {
+			return err
+		}
+		if rev == "" {
+			fmt.Fprintf(w, "%s\tnot installed\t\t\n", gom.name)
+			continue
+		}
+
+		pin := "-"
+		if kind, ref := gom.pin(); kind != "" {
+			d, err := gom.checkRevision(vendor)
+			if _, ok := err.(unverifiable); ok {
+				pin = "cannot verify " + kind + " " + ref
+			} else if err != nil {
+				return err
+			} else if d == nil {
+				pin = "at " + kind + " " + ref
+			} else {
+				pin = "not at " + kind + " " + ref
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", gom.name, rev, changes, pin)
+	}
+	return w.Flush()
+}
+
+// vendoredState returns the revision gom is vendored at, or "" if it isn't
+// installed, and whether its checkout has uncommitted changes. A module has
+// no checkout, so its changes are "-".
+func (gom *Gom) vendoredState(vendor string) (rev, changes string, err error) {
+	if gom.module() {
+		return vendoredModuleVersion(gom.cacheSrcDir(vendor)), "-", nil
+	}
+	p, vcs := gom.findVCS(vendorSrc(vendor))
+	if vcs == nil {
+		return "", "", nil
+	}
+	rev, err = gom.revisionAt(vcs, p)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", gom.name, err)
+	}
+	changes = "clean"
+	if dirty, err := vcs.Dirty(p); err != nil {
+		changes = "unknown"
+	} else if dirty {
+		changes = "dirty"
+	}
+	return rev, changes, nil
+}
+
+// revisionAt returns the revision of gom checked out at p. For bzr that is
+// the revision id, unless the revno option asks for the revision number,
+// which isn't stable across branches but older pins used.
+func (gom *Gom) revisionAt(vcs *vcsCmd, p string) (string, error) {
+	if revno, _ := gom.options["revno"].(string); revno == "true" && vcs == bzr {
+		out, err := vcsOutput(p, "bzr", "revno")
+		return strings.TrimSpace(out), err
+	}
+	return vcs.Revision(p)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor, _, second := verifyRepo(t, dir)
+	clean := filepath.Join(vendorSrc(vendor), "example.com", "clean")
+	gitRepo(t, clean, map[string]string{"c.go": "package c\n"})
+	cleanRev := gitOutput(t, clean, "rev-parse", "HEAD")
+	err = ioutil.WriteFile(filepath.Join(vendorSrc(vendor), "example.com", "repo", "a.go"), []byte("package changed\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = vendor
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(*gomFileName, []byte(`
+gom 'example.com/repo', :tag => 'v1'
+gom 'example.com/clean', :commit => '`+cleanRev+`'
+gom 'example.com/missing'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := status(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	expected := [][]string{
+		{"PACKAGE", "REVISION", "CHANGES", "PIN"},
+		{"example.com/repo", second, "dirty", "not", "at", "tag", "v1"},
+		{"example.com/clean", cleanRev, "clean", "at", "commit", cleanRev},
+		{"example.com/missing", "not", "installed"},
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %v, but %v:", len(expected), out)
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != strings.Join(expected[i], " ") {
+			t.Fatalf("Expected %v, but %v:", strings.Join(expected[i], " "), got)
+		}
+	}
+}
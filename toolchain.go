@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// re_toolchain matches the Go releases golang.org/dl has a command for.
+var re_toolchain = regexp.MustCompile(`^go1(\.[0-9]+)*((rc|beta)[0-9]+)?$`)
+
+// toolchains caches the go commands the go options resolved to.
+var toolchains = struct {
+	sync.Mutex
+	paths map[string]string
+}{paths: make(map[string]string)}
+
+// goCommand returns the go command gom is built with: the Go toolchain of
+// its go option, or else go.
+func (gom *Gom) goCommand(out, errOut io.Writer) (string, error) {
+	version, ok := gom.options["go"].(string)
+	if !ok {
+		return "go", nil
+	}
+	if filepath.IsAbs(version) {
+		return version, nil
+	}
+
+	toolchains.Lock()
+	defer toolchains.Unlock()
+	if p, ok := toolchains.paths[version]; ok {
+		return p, nil
+	}
+	p, err := resolveToolchain(version, out, errOut)
+	if err != nil {
+		return "", fmt.Errorf("%s: can't get Go toolchain %s: %v", gom.name, version, err)
+	}
+	toolchains.paths[version] = p
+	return p, nil
+}
+
+// resolveToolchain returns the go command of the Go release version. That
+// is the command golang.org/dl installed for it, if it is in PATH, or else
+// the go of the SDK it downloads to ~/sdk, which is downloaded first with
+// go run golang.org/dl/version if it isn't there yet.
+func resolveToolchain(version string, out, errOut io.Writer) (string, error) {
+	if p, err := exec.LookPath(version); err == nil {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(home, "sdk", version, "bin", "go")
+	if isFile(p) || *dryRun {
+		return p, nil
+	}
+	fmt.Fprintf(out, "downloading Go toolchain %s\n", version)
+	// outside of any module, whose go.mod would otherwise be used
+	err = vcsExecOut(os.TempDir(), []string{"GO111MODULE=on"}, out, errOut,
+		"go", "run", "golang.org/dl/"+version+"@latest", "download")
+	if err != nil {
+		return "", err
+	}
+	if !isFile(p) {
+		return "", fmt.Errorf("%s isn't there after the download", p)
+	}
+	return p, nil
+}
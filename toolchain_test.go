@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a golang.org/dl command in PATH
+	wrapper := filepath.Join(dir, "go1.99")
+	err = ioutil.WriteFile(wrapper, []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	tests := []struct {
+		option   interface{}
+		expected string
+	}{
+		{nil, "go"},
+		{"/usr/local/go1.19/bin/go", "/usr/local/go1.19/bin/go"},
+		{"go1.99", wrapper},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}
+		if test.option != nil {
+			gom.options["go"] = test.option
+		}
+		p, err := gom.goCommand(ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != test.expected {
+			t.Fatalf("Expected %v, but %v:", test.expected, p)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tracePhases are the phases of an install that -trace sums up, in order.
+var tracePhases = []string{"clone", "checkout", "build"}
+
+// traceCommand returns what to call once args has run: with -trace, it
+// prints when the command started and ended, how long it took, and the
+// directory it ran in. What it prints goes to stderr, even with -q.
+func traceCommand(args []string) func(dir string, err error) {
+	if !*trace {
+		return func(string, error) {}
+	}
+	start := time.Now()
+	return func(dir string, err error) {
+		end := time.Now()
+		where := ""
+		if dir != "" {
+			where = " in " + dir
+		}
+		failed := ""
+		if err != nil {
+			failed = " (failed)"
+		}
+		fmt.Fprintf(os.Stderr, "trace: %s-%s %8s %s%s%s\n",
+			start.Format("15:04:05.000"), end.Format("15:04:05.000"), end.Sub(start).Round(time.Millisecond),
+			redact(strings.Join(args, " ")), where, failed)
+	}
+}
+
+// writeTrace writes how long every gom took in each phase of the install,
+// the slowest first, and the total of each phase.
+func (rs *installResults) writeTrace(w io.Writer) error {
+	list := make([]*installResult, len(rs.list))
+	copy(list, rs.list)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Duration > list[j].Duration
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "PACKAGE\t%s\tTOTAL\n", strings.ToUpper(strings.Join(tracePhases, "\t")))
+	totals := make(map[string]time.Duration)
+	var total time.Duration
+	for _, r := range list {
+		fmt.Fprintf(tw, "%s\t", r.ImportPath)
+		var sum time.Duration
+		for _, phase := range tracePhases {
+			d := r.phases[phase]
+			fmt.Fprintf(tw, "%s\t", d.Round(time.Millisecond))
+			totals[phase] += d
+			sum += d
+		}
+		total += sum
+		fmt.Fprintf(tw, "%s\n", sum.Round(time.Millisecond))
+	}
+	fmt.Fprint(tw, "TOTAL\t")
+	for _, phase := range tracePhases {
+		fmt.Fprintf(tw, "%s\t", totals[phase].Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "%s\n", total.Round(time.Millisecond))
+	return tw.Flush()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteTrace(t *testing.T) {
+	rs := &installResults{byName: make(map[string]*installResult)}
+	rs.get("example.com/fast").phases = map[string]time.Duration{"clone": 10 * time.Millisecond}
+	rs.get("example.com/slow").phases = map[string]time.Duration{"clone": time.Second, "build": 500 * time.Millisecond}
+	rs.get("example.com/fast").Duration = 0.01
+	rs.get("example.com/slow").Duration = 1.5
+	rs.get("example.com/none")
+
+	var buf bytes.Buffer
+	if err := rs.writeTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `PACKAGE           CLONE  CHECKOUT  BUILD  TOTAL
+example.com/slow  1s     0s        500ms  1.5s
+example.com/fast  10ms   0s        0s     10ms
+example.com/none  0s     0s        0s     0s
+TOTAL             1.01s  0s        500ms  1.51s
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+}
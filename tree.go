@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tree prints the import graph of the vendored packages, rooted at the
+// Gomfile entries. Imports that resolve outside the vendor tree are
+// flagged, since those leak in from the outer GOPATH.
+func tree() error {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	ctx := build.Default
+	ctx.GOPATH = prependPath(os.Getenv("GOPATH"), vendor)
+	t := &importTree{
+		ctx:    &ctx,
+		src:    vendorSrc(vendor),
+		srcDir: cwd,
+		seen:   make(map[string]bool),
+	}
+	for _, gom := range filterGoms(allGoms) {
+		t.print(gom.Target(), 0)
+	}
+	return nil
+}
+
+type importTree struct {
+	ctx    *build.Context
+	src    string // the vendor source directory
+	srcDir string // the directory imports are resolved from
+	seen   map[string]bool
+}
+
+func (t *importTree) print(path string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	pkg, err := t.ctx.Import(path, t.srcDir, 0)
+	if err != nil && pkg.Dir == "" {
+		fmt.Printf("%s%s (not found)\n", indent, path)
+		return
+	}
+	if !strings.HasPrefix(pkg.Dir, t.src+string(filepath.Separator)) {
+		fmt.Printf("%s%s (outside vendor: %s)\n", indent, path, pkg.Dir)
+		return
+	}
+	if t.seen[path] {
+		fmt.Printf("%s%s (see above)\n", indent, path)
+		return
+	}
+	fmt.Printf("%s%s\n", indent, path)
+	t.seen[path] = true
+
+	for _, imp := range pkg.Imports {
+		if isStandardImport(imp) {
+			continue
+		}
+		t.print(imp, depth+1)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout returns what f prints to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestImportTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor := filepath.Join(dir, "_vendor")
+	outer := filepath.Join(dir, "gopath")
+	pkgs := map[string]string{
+		filepath.Join(vendor, "src", "example.com", "a"): `package a
+import (
+	_ "example.com/b"
+	_ "example.com/c"
+	_ "example.com/missing"
+	_ "fmt"
+)`,
+		filepath.Join(vendor, "src", "example.com", "b"): `package b
+import _ "example.com/c"`,
+		filepath.Join(vendor, "src", "example.com", "c"):   `package c`,
+		filepath.Join(outer, "src", "example.com", "leak"): `package leak`,
+		filepath.Join(vendor, "src", "example.com", "d"): `package d
+import _ "example.com/leak"`,
+	}
+	for p, src := range pkgs {
+		err = os.MkdirAll(p, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(p, "p.go"), []byte(src+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := build.Default
+	ctx.GOPATH = vendor + string(filepath.ListSeparator) + outer
+	tree := &importTree{
+		ctx:    &ctx,
+		src:    filepath.Join(vendor, "src"),
+		srcDir: dir,
+		seen:   make(map[string]bool),
+	}
+	out := captureStdout(t, func() {
+		tree.print("example.com/a", 0)
+		tree.print("example.com/d", 0)
+	})
+	expected := `example.com/a
+  example.com/b
+    example.com/c
+  example.com/c (see above)
+  example.com/missing (not found)
+example.com/d
+  example.com/leak (outside vendor: ` + filepath.Join(outer, "src", "example.com", "leak") + `)
+`
+	if out != expected {
+		t.Fatalf("Expected %v, but %v:", expected, out)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// update fetches the latest revision of a single gom, checks out its
+// configured branch/tag/commit again and rebuilds it. A git branch moves
+// to its tip upstream, unless it is the branch of a date.
+func update(args []string) error {
+	if len(args) == 0 {
+		return errors.New("gom update: missing import path")
+	}
+	if *offline {
+		return errors.New("gom update: can't fetch with -offline")
+	}
+	name, args := args[0], args[1:]
+
+	allGoms, err := parseGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	err = validateGoms(allGoms)
+	if err != nil {
+		return err
+	}
+	var gom *Gom
+	for i := range allGoms {
+		if allGoms[i].name == name {
+			gom = &allGoms[i]
+			break
+		}
+	}
+	if gom == nil {
+		return fmt.Errorf("%s is not in %s", name, *gomFileName)
+	}
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	defer saveEnv("GOPATH", "GOBIN")()
+	defer restoreMoved()
+	err = setupVendorEnv(vendor)
+	if err != nil {
+		return err
+	}
+	if flatSrc(vendor) != "" {
+		err = moveSrcToVendorSrc(vendor)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = gom.update(vendor, args)
+	if err != nil {
+		return err
+	}
+
+	if flatSrc(vendor) != "" {
+		return moveSrcToVendor(vendor)
+	}
+	return nil
+}
+
+func (gom *Gom) update(vendor string, args []string) error {
+	var err error
+	downloaded := false
+	if gom.module() {
+		// go mod download resolves the version again
+		downloaded, err = gom.fetchModule(vendor)
+	}
+	if !downloaded {
+		err = gom.updateCheckout(vendor, args)
+	}
+	if err != nil {
+		return err
+	}
+	err = gom.PostInstall()
+	if err != nil {
+		return err
+	}
+	if skipdep, ok := gom.options["skipdep"].(string); ok {
+		if skipdep == "true" {
+			return nil
+		}
+	}
+	return gom.Build(args)
+}
+
+// updateCheckout fetches the latest revisions of the repository of gom and
+// checks out its pin again.
+func (gom *Gom) updateCheckout(vendor string, args []string) error {
+	p, vcs := gom.findVCS(filepath.Join(vendor, "src"))
+	branch, tracked := gom.options["branch"].(string)
+	tracked = tracked && vcs == git && !has(gom.options, "date")
+	if vcs == nil {
+		// not installed yet
+		err := gom.Clone(args)
+		if err != nil {
+			return err
+		}
+	} else if tracked {
+		// the local branch stays where it was cloned, so move to the tip
+		// of the branch upstream instead
+		fmt.Printf("updating %s\n", gom.name)
+		err := vcs.Track(p, gom.remote(), branch)
+		if err != nil {
+			return err
+		}
+	} else if kind, ref := gom.pin(); kind != "" {
+		fmt.Printf("updating %s\n", gom.name)
+		err := vcs.UpdateRef(p, kind, ref)
+		if err != nil {
+			return err
+		}
+	} else {
+		// nothing is pinned, so let go get move it to the latest revision
+		fmt.Printf("updating %s\n", gom.name)
+		cmdArgs := []string{"go", "get", "-d", "-u"}
+		if gom.insecure() {
+			cmdArgs = append(cmdArgs, "-insecure")
+		}
+		err := gom.goGet(append(cmdArgs, gom.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !tracked {
+		err := gom.Checkout()
+		if err != nil {
+			return err
+		}
+	}
+	err := gom.Submodules()
+	if err != nil {
+		return err
+	}
+	return gom.LFS()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateBranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upstream := filepath.Join(dir, "upstream")
+	gitRepo(t, upstream, map[string]string{"a.go": "package a\n"})
+	gitRun(t, upstream, "branch", "-q", "-M", "dev")
+
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	vendor := vendorFolder
+	src := filepath.Join(vendor, "src", "example.com")
+	err = os.MkdirAll(src, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, src, "clone", "-q", "-b", "dev", upstream, "repo")
+
+	err = ioutil.WriteFile(filepath.Join(upstream, "b.go"), []byte("package a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "second")
+
+	gom := Gom{name: "example.com/repo", options: map[string]interface{}{
+		"branch":  "dev",
+		"skipdep": "true",
+	}}
+	err = gom.update(vendor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(src, "repo", "b.go")) {
+		t.Fatalf("Expected %v, but %v:", "tip of dev", "stale checkout")
+	}
+	tip := gitOutput(t, upstream, "rev-parse", "HEAD")
+	head := gitOutput(t, filepath.Join(src, "repo"), "rev-parse", "HEAD")
+	if head != tip {
+		t.Fatalf("Expected %v, but %v:", tip, head)
+	}
+}
+
+func TestUpdateBranchDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("GIT_COMMITTER_DATE", os.Getenv("GIT_COMMITTER_DATE"))
+
+	upstream := filepath.Join(dir, "upstream")
+	os.Setenv("GIT_COMMITTER_DATE", "2016-01-01T12:00:00Z")
+	gitRepo(t, upstream, map[string]string{"a.go": "package a\n"})
+	gitRun(t, upstream, "branch", "-q", "-M", "dev")
+	first := gitOutput(t, upstream, "rev-parse", "HEAD")
+	err = ioutil.WriteFile(filepath.Join(upstream, "b.go"), []byte("package a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GIT_COMMITTER_DATE", "2016-06-01T12:00:00Z")
+	gitRun(t, upstream, "add", "-A")
+	gitRun(t, upstream, "commit", "-q", "-m", "second")
+
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = filepath.Join(dir, "_vendor")
+	src := filepath.Join(vendorFolder, "src", "example.com")
+	err = os.MkdirAll(src, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, src, "clone", "-q", "-b", "dev", upstream, "repo")
+
+	// the date wins over the tip of the branch
+	gom := Gom{name: "example.com/repo", options: map[string]interface{}{
+		"branch":  "dev",
+		"date":    "2016-03-01",
+		"skipdep": "true",
+	}}
+	err = gom.update(vendorFolder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := gitOutput(t, filepath.Join(src, "repo"), "rev-parse", "HEAD")
+	if head != first {
+		t.Fatalf("Expected %v, but %v:", first, head)
+	}
+}
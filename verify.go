@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// drift describes a gom whose checkout isn't at the revision it is pinned to.
+type drift struct {
+	gom      Gom
+	kind     string // commit, tag, branch, bookmark or date
+	ref      string // the pinned ref as written in the Gomfile
+	expected string // the revision ref resolves to
+	actual   string // the revision that is checked out
+}
+
+// pin returns the kind and value of the ref gom is pinned to. Only one of
+// them should be set, but when there are several a commit wins over a
+// tag, a tag over a branch and a branch over a bookmark.
+func (gom *Gom) pin() (string, string) {
+	for _, kind := range []string{"commit", "tag", "branch", "bookmark"} {
+		if ref, ok := gom.options[kind].(string); ok {
+			return kind, ref
+		}
+	}
+	return "", ""
+}
+
+// re_hex matches revisions written as hexadecimal hashes.
+var re_hex = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// sameRevision compares revisions. Hashes may be abbreviated to 7 or more
+// characters, while revision numbers such as those of svn and bzr must
+// match exactly.
+func sameRevision(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 7 && re_hex.MatchString(a) && re_hex.MatchString(b) && strings.HasPrefix(b, a)
+}
+
+// unverifiable is the error of checkRevision for a gom pinned to a tag or
+// branch that its VCS can't resolve to a revision.
+type unverifiable struct {
+	name string
+	kind string
+	ref  string
+}
+
+func (e unverifiable) Error() string {
+	return fmt.Sprintf("%s: cannot verify %s %s", e.name, e.kind, e.ref)
+}
+
+// checkRevision compares the checked out revision of gom with its pin. It
+// returns nil when gom isn't pinned or is at the pinned revision, and an
+// unverifiable error when its VCS can't resolve the pin.
+func (gom *Gom) checkRevision(vendor string) (*drift, error) {
+	if date, ok := gom.options["date"].(string); ok {
+		return gom.checkDate(vendor, date)
+	}
+	kind, ref := gom.pin()
+	if kind == "" {
+		return nil, nil
+	}
+	d := &drift{gom: *gom, kind: kind, ref: ref}
+
+	target := gom.Target()
+	if gom.module() {
+		d.expected = ref
+		d.actual = vendoredModuleVersion(filepath.Join(vendorSrc(vendor), filepath.FromSlash(target)))
+		if d.actual == "" {
+			d.actual = "not installed"
+		} else if moduleAt(d.actual, kind, ref) {
+			return nil, nil
+		}
+		return d, nil
+	}
+	p, vcs := gom.findVCS(vendorSrc(vendor))
+	if vcs == nil {
+		d.actual = "not installed"
+		return d, nil
+	}
+	if kind != "commit" && vcs.resolve == nil {
+		return nil, unverifiable{gom.name, kind, ref}
+	}
+	actual, err := vcs.Revision(p)
+	if err != nil {
+		return nil, err
+	}
+	d.actual = actual
+
+	switch kind {
+	case "commit":
+		d.expected = ref
+		if vcs == bzr && isRevno(ref) {
+			d.expected, err = vcs.Resolve(p, ref)
+		}
+	case "branch":
+		// compare with the fetched remote branch when there is one
+		if vcs.remoteBranches {
+			d.expected, err = vcs.Resolve(p, gom.remote()+"/"+ref)
+		}
+		if d.expected == "" {
+			d.expected, err = vcs.Resolve(p, ref)
+		}
+	case "tag":
+		if isTagPattern(ref) && vcs == git {
+			// the newest matching tag fetched so far
+			var out string
+			if out, err = vcsOutput(p, "git", "tag", "-l", ref); err == nil {
+				var tag string
+				if tag, err = matchingTag(strings.Fields(out), ref); err == nil {
+					d.expected, err = vcs.Resolve(p, vcs.Ref(kind, tag))
+				}
+			}
+			break
+		}
+		d.expected, err = vcs.Resolve(p, vcs.Ref(kind, ref))
+	default:
+		d.expected, err = vcs.Resolve(p, vcs.Ref(kind, ref))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gom.name, err)
+	}
+	if sameRevision(d.expected, d.actual) {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// verify checks that every installed gom is at the revision the Gomfile
+// pins it to and fails if any of them drifted.
+func verify() error {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	drifted, err := reportDrift(vendor, filterGoms(allGoms))
+	if err != nil {
+		return err
+	}
+	err = checkLockedTags(vendor, filterGoms(allGoms))
+	if err != nil {
+		return err
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d packages drifted from %s", drifted, *gomFileName)
+	}
+	return nil
+}
+
+// reportDrift prints the goms that aren't at their pinned revision and
+// returns how many there are.
+func reportDrift(vendor string, goms []Gom) (int, error) {
+	drifted := 0
+	for _, gom := range goms {
+		d, err := gom.checkRevision(vendor)
+		if _, ok := err.(unverifiable); ok {
+			fmt.Printf("Warning: %v\n", err)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if d == nil {
+			if *verbose {
+				fmt.Printf("%s: ok\n", gom.name)
+			}
+			continue
+		}
+		drifted++
+		fmt.Printf("%s\n", gom.name)
+		if d.expected == "" || d.expected == d.ref {
+			fmt.Printf("  - %s %s\n", d.kind, d.ref)
+		} else {
+			fmt.Printf("  - %s (%s %s)\n", d.expected, d.kind, d.ref)
+		}
+		fmt.Printf("  + %s\n", d.actual)
+	}
+	return drifted, nil
+}
+
+// checkFrozen fails unless every gom is installed, at the revision it is
+// pinned to, without fetching or changing anything.
+func checkFrozen() error {
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	err = validateGoms(allGoms)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	goms := filterGoms(allGoms)
+
+	missing := 0
+	for _, gom := range goms {
+		target := gom.Target()
+		// checkRevision reports the pinned goms that are missing
+		if kind, _ := gom.pin(); kind == "" && !isDir(filepath.Join(vendorSrc(vendor), filepath.FromSlash(target))) {
+			missing++
+			fmt.Printf("%s\n  + not installed\n", gom.name)
+		}
+	}
+	drifted, err := reportDrift(vendor, goms)
+	if err != nil {
+		return err
+	}
+	if missing+drifted > 0 {
+		return fmt.Errorf("%d packages are out of date with %s", missing+drifted, *gomFileName)
+	}
+	return nil
+}
+
+// checkLockedTags warns about the tags recorded in the lock file that now
+// point to another commit than the one locked with them, which means the
+// tag was moved upstream.
+func checkLockedTags(vendor string, goms []Gom) error {
+	lockfile := *gomFileName + ".lock"
+	if !isFile(lockfile) {
+		return nil
+	}
+	locked, err := parseGomfile(lockfile)
+	if err != nil {
+		return err
+	}
+	targets := make(map[string]string)
+	for _, gom := range goms {
+		targets[gom.name] = gom.Target()
+	}
+	for _, l := range locked {
+		tag, ok := l.options["tag"].(string)
+		commit, ok2 := l.options["commit"].(string)
+		target, ok3 := targets[l.name]
+		if !ok || !ok2 || !ok3 {
+			continue
+		}
+		p, vcs := findVCS(vendorSrc(vendor), target)
+		if vcs == nil {
+			continue
+		}
+		rev, err := vcs.Resolve(p, vcs.Ref("tag", tag))
+		if err != nil || rev == "" {
+			// the tag is gone, or the VCS can't resolve tags
+			continue
+		}
+		if !sameRevision(rev, commit) {
+			fmt.Printf("Warning: tag %s of %s points to %s now, but %s locked it at %s\n", tag, l.name, rev, lockfile, commit)
+		}
+	}
+	return nil
+}
+
+// checkDate compares the checked out revision of gom with its last commit
+// before date.
+func (gom *Gom) checkDate(vendor, date string) (*drift, error) {
+	d := &drift{gom: *gom, kind: "date", ref: date}
+	p, vcs := gom.findVCS(vendorSrc(vendor))
+	if vcs != git {
+		d.actual = "not installed"
+		return d, nil
+	}
+	actual, err := vcs.Revision(p)
+	if err != nil {
+		return nil, err
+	}
+	d.actual = actual
+	d.expected, err = gom.dateCommit(p, date)
+	if err != nil {
+		return nil, err
+	}
+	if sameRevision(d.expected, d.actual) {
+		return nil, nil
+	}
+	return d, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameRevision(t *testing.T) {
+	full := "36e6bb17c1fb1ac8f1f3d8b4d3e3a0c1da4e6b2f"
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{full, full, true},
+		{full[:12], full, true},
+		{full, full[:7], true},
+		{full[:6], full, false},
+		{"6b0e5b5", full, false},
+		{"r12", "r1234", false},
+		{"12", "1234", false},
+		{"1234", "1234", true},
+		{"4", "42", false},
+		{"1234567", "12345678", true},
+		{"v1.2.3", "v1.2.3-rc1", false},
+		{"", full, false},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		if got := sameRevision(test.a, test.b); got != test.expected {
+			t.Fatalf("Expected %v, but %v: %q %q", test.expected, got, test.a, test.b)
+		}
+	}
+}
+
+// verifyRepo creates a vendor directory holding a git checkout of
+// example.com/repo with a tag v1 on its first commit and HEAD at the
+// second commit on branch main. It returns the vendor directory and both
+// revisions.
+func verifyRepo(t *testing.T, dir string) (string, string, string) {
+	vendor := filepath.Join(dir, "_vendor")
+	repo := filepath.Join(vendorSrc(vendor), "example.com", "repo")
+	gitRepo(t, repo, map[string]string{"a.go": "package a\n"})
+	gitRun(t, repo, "branch", "-q", "-M", "main")
+	gitRun(t, repo, "tag", "v1")
+	first := gitOutput(t, repo, "rev-parse", "HEAD")
+	err := ioutil.WriteFile(filepath.Join(repo, "b.go"), []byte("package a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, repo, "add", "-A")
+	gitRun(t, repo, "commit", "-q", "-m", "second")
+	return vendor, first, gitOutput(t, repo, "rev-parse", "HEAD")
+}
+
+func TestCheckRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor, first, second := verifyRepo(t, dir)
+
+	tests := []struct {
+		kind     string
+		ref      string
+		expected string // the expected revision of the drift, if any
+	}{
+		{"commit", second, ""},
+		{"commit", second[:7], ""},
+		{"commit", first, first},
+		{"tag", "v1", first},
+		{"branch", "main", ""},
+	}
+	for _, test := range tests {
+		gom := Gom{name: "example.com/repo", options: map[string]interface{}{test.kind: test.ref}}
+		d, err := gom.checkRevision(vendor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.expected == "" {
+			if d != nil {
+				t.Fatalf("Expected %v, but %v: %s %s", nil, d.actual, test.kind, test.ref)
+			}
+			continue
+		}
+		if d == nil || d.expected != test.expected || d.actual != second {
+			t.Fatalf("Expected %v, but %v: %s %s", test.expected, d, test.kind, test.ref)
+		}
+	}
+
+	gom := Gom{name: "example.com/missing", options: map[string]interface{}{"tag": "v1"}}
+	d, err := gom.checkRevision(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d == nil || d.actual != "not installed" {
+		t.Fatalf("Expected %v, but %v:", "not installed", d)
+	}
+}
+
+func TestCheckRevisionUnverifiable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor := filepath.Join(dir, "_vendor")
+	src := vendorSrc(vendor)
+	err = os.MkdirAll(filepath.Join(src, "example.com", "svnrepo", ".svn"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(src, "example.com", "fslrepo"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "example.com", "fslrepo", ".fslckout"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{"example.com/svnrepo", "tag"},
+		{"example.com/svnrepo", "branch"},
+		{"example.com/fslrepo", "tag"},
+		{"example.com/fslrepo", "branch"},
+	}
+	for _, test := range tests {
+		gom := Gom{name: test.name, options: map[string]interface{}{test.kind: "v1"}}
+		_, err := gom.checkRevision(vendor)
+		if _, ok := err.(unverifiable); !ok {
+			t.Fatalf("Expected %v, but %v: %s %s", "cannot verify", err, test.name, test.kind)
+		}
+	}
+}
+
+func TestVerifySkipsUnverifiable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor, first, second := verifyRepo(t, dir)
+	err = os.MkdirAll(filepath.Join(vendorSrc(vendor), "example.com", "svnrepo", ".svn"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = vendor
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = filepath.Join(dir, "Gomfile")
+
+	for _, test := range []struct {
+		commit string
+		ok     bool
+	}{
+		{second, true},
+		{first, false},
+	} {
+		err = ioutil.WriteFile(*gomFileName, []byte(`
+gom 'example.com/svnrepo', :tag => 'v1'
+gom 'example.com/repo', :commit => '`+test.commit+`'
+`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = verify()
+		if (err == nil) != test.ok {
+			t.Fatalf("Expected %v, but %v:", test.ok, err)
+		}
+	}
+}
+
+func TestCheckFrozen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vendor, first, second := verifyRepo(t, dir)
+	err = os.MkdirAll(filepath.Join(vendorSrc(vendor), "example.com", "svnrepo", ".svn"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { vendorFolder = v }(vendorFolder)
+	vendorFolder = vendor
+	defer func(v string) { *gomFileName = v }(*gomFileName)
+	*gomFileName = filepath.Join(dir, "Gomfile")
+	defer func(v bool) { *frozen = v }(*frozen)
+	*frozen = true
+
+	tests := []struct {
+		gomfile string
+		ok      bool
+	}{
+		{"gom 'example.com/repo', :commit => '" + second + "'", true},
+		{"gom 'example.com/repo', :branch => 'main'", true},
+		{"gom 'example.com/svnrepo', :tag => 'v1'", true},
+		{"gom 'example.com/repo', :commit => '" + first + "'", false},
+		{"gom 'example.com/repo', :tag => 'v1'", false},
+		{"gom 'example.com/unpinned'", false},
+		{"gom 'example.com/missing', :tag => 'v1'", false},
+	}
+	for _, test := range tests {
+		err = ioutil.WriteFile(*gomFileName, []byte(test.gomfile+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = install(nil)
+		if (err == nil) != test.ok {
+			t.Fatalf("Expected %v, but %v: %s", test.ok, err, test.gomfile)
+		}
+	}
+}
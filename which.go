@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// which prints the directory the package importPath is vendored in, or
+// would be, and then its revision, or that it isn't installed.
+func which(args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	allGoms, err := loadGomfile(*gomFileName)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	path := vendorPath(allGoms, args[0])
+	p := filepath.Join(vendorSrc(vendor), filepath.FromSlash(path))
+	fmt.Println(p)
+	root, vcs := findVCS(vendorSrc(vendor), path)
+	if vcs == nil || !isDir(p) {
+		fmt.Println("not installed")
+		return nil
+	}
+	rev, err := vcs.Revision(root)
+	if err != nil {
+		return err
+	}
+	fmt.Println(rev)
+	return nil
+}
+
+// vendorPath returns where below the vendor source directory importPath
+// goes, moved along with the target option of the gom it belongs to.
+func vendorPath(goms []Gom, importPath string) string {
+	var found *Gom
+	for i, gom := range goms {
+		if importPath != gom.name && !strings.HasPrefix(importPath, gom.name+"/") {
+			continue
+		}
+		if found == nil || len(gom.name) > len(found.name) {
+			found = &goms[i]
+		}
+	}
+	if found == nil {
+		return importPath
+	}
+	return found.Target() + strings.TrimPrefix(importPath, found.name)
+}
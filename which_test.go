@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVendorPath(t *testing.T) {
+	goms := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{}},
+		{name: "gopkg.in/yaml.v2", options: map[string]interface{}{"target": "github.com/go-yaml/yaml"}},
+		{name: "gopkg.in/yaml.v2/sub", options: map[string]interface{}{"target": "sub"}},
+	}
+	for _, tt := range []struct {
+		importPath string
+		expected   string
+	}{
+		{"github.com/mattn/go-sqlite3", "github.com/mattn/go-sqlite3"},
+		{"gopkg.in/yaml.v2", "github.com/go-yaml/yaml"},
+		{"gopkg.in/yaml.v2/parser", "github.com/go-yaml/yaml/parser"},
+		{"gopkg.in/yaml.v2/sub/x", "sub/x"},
+		{"gopkg.in/yaml.v22", "gopkg.in/yaml.v22"},
+		{"example.com/unlisted", "example.com/unlisted"},
+	} {
+		if path := vendorPath(goms, tt.importPath); path != tt.expected {
+			t.Fatalf("Expected %v, but %v:", tt.expected, path)
+		}
+	}
+}